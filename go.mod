@@ -6,6 +6,7 @@ require (
 	github.com/gin-gonic/gin v1.11.0
 	github.com/makiuchi-d/gozxing v0.1.1
 	gocv.io/x/gocv v0.42.0
+	golang.org/x/image v0.29.0
 )
 
 require (
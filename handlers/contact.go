@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Aashish23092/aadhaar-qr-service/services"
+	"github.com/gin-gonic/gin"
+)
+
+// verifyContactRequest takes either the raw numeric QR payload or the
+// hashes returned by /decode, plus the candidate contact details. Only a
+// qr_data payload whose UIDAI signature verifies can produce a match:
+// bare hashes, like a self-made QR, prove nothing about the resident.
+type verifyContactRequest struct {
+	QRData       string `json:"qr_data"`
+	MobileHash   string `json:"mobile_hash"`
+	EmailHash    string `json:"email_hash"`
+	AadhaarLast4 string `json:"aadhaar_last4"`
+	Mobile       string `json:"mobile"`
+	Email        string `json:"email"`
+}
+
+func (h *QRHandler) VerifyContact(c *gin.Context) {
+	var req verifyContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Println("VERIFY ERROR: invalid request body:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	hashes := services.ContactHashes{
+		MobileHash:   req.MobileHash,
+		EmailHash:    req.EmailHash,
+		AadhaarLast4: req.AadhaarLast4,
+	}
+	if req.QRData != "" {
+		fromQR, err := services.ContactHashesFromQR([]byte(req.QRData), h.PublicKey)
+		if err != nil {
+			log.Println("VERIFY ERROR: qr_data parse failed:", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "qr_data is not a Secure QR payload"})
+			return
+		}
+		if req.AadhaarLast4 != "" {
+			fromQR.AadhaarLast4 = req.AadhaarLast4
+		}
+		hashes = fromQR
+	}
+	if !hashes.SignatureValid {
+		log.Println("VERIFY WARNING: signature not verified, no match will be reported")
+	}
+
+	res, err := services.VerifyContact(hashes, req.Mobile, req.Email)
+	if err != nil {
+		log.Println("VERIFY ERROR:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/Aashish23092/aadhaar-qr-service/services"
+	"github.com/gin-gonic/gin"
+)
+
+// maxOfflineKYCSize bounds the uploaded ZIP; UIDAI files are a few KB.
+const maxOfflineKYCSize = 5 << 20
+
+// OfflineKYC accepts an Offline Paperless e-KYC ZIP ("file") and its
+// share code ("share_code") and responds like POST /decode.
+func (h *QRHandler) OfflineKYC(c *gin.Context) {
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		log.Println("OFFLINE KYC ERROR: No file in request:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file missing"})
+		return
+	}
+	defer file.Close()
+
+	zipBytes, err := io.ReadAll(io.LimitReader(file, maxOfflineKYCSize+1))
+	if err != nil {
+		log.Println("OFFLINE KYC ERROR: Unable to read file bytes:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return
+	}
+	if len(zipBytes) > maxOfflineKYCSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file too large"})
+		return
+	}
+	log.Println("OFFLINE KYC: ZIP received, size:", len(zipBytes))
+
+	parsed, err := services.ParseOfflineKYCZip(zipBytes, c.PostForm("share_code"), h.PublicKey)
+	if err != nil {
+		log.Println("OFFLINE KYC ERROR:", err)
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrZipPassword) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	log.Println("OFFLINE KYC SUCCESS: parsed as", parsed.Type)
+
+	resp := gin.H{
+		"type":   parsed.Type,
+		"data":   parsed.Data,
+		"format": parsed.Info,
+	}
+	if photo := h.describePhoto(parsed.Photo, c.Query("photo_format")); photo != nil {
+		resp["photo"] = photo
+	}
+	c.JSON(http.StatusOK, resp)
+}
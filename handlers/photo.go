@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Aashish23092/aadhaar-qr-service/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// photoTTL bounds how long a decoded resident photo stays retrievable
+// through GET /decode/:id/photo.
+const photoTTL = 10 * time.Minute
+
+// Photos are personal data, so the store is also capped in entries and
+// bytes; the oldest photos are dropped first to make room.
+const (
+	maxPhotoEntries = 1024
+	maxPhotoBytes   = 64 << 20
+)
+
+type photoEntry struct {
+	raw     []byte
+	expires time.Time
+}
+
+// photoStore keeps recently decoded photos in memory so clients can fetch
+// them as a separate resource instead of inline base64.
+type photoStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int
+	size       int
+	items      map[string]photoEntry
+}
+
+func newPhotoStore(ttl time.Duration) *photoStore {
+	return &photoStore{ttl: ttl, maxEntries: maxPhotoEntries, maxBytes: maxPhotoBytes, items: make(map[string]photoEntry)}
+}
+
+func (s *photoStore) Put(raw []byte) (string, error) {
+	if len(raw) > s.maxBytes {
+		return "", fmt.Errorf("photo too large to store (%d bytes)", len(raw))
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("photo ID: %v", err)
+	}
+	id := hex.EncodeToString(b[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range s.items {
+		if now.After(e.expires) {
+			s.remove(k)
+		}
+	}
+	// Every entry has the same TTL, so the earliest expiry is the oldest.
+	for len(s.items) >= s.maxEntries || s.size+len(raw) > s.maxBytes {
+		oldest := ""
+		for k, e := range s.items {
+			if oldest == "" || e.expires.Before(s.items[oldest].expires) {
+				oldest = k
+			}
+		}
+		s.remove(oldest)
+	}
+	s.items[id] = photoEntry{raw: raw, expires: now.Add(s.ttl)}
+	s.size += len(raw)
+	return id, nil
+}
+
+func (s *photoStore) remove(id string) {
+	s.size -= len(s.items[id].raw)
+	delete(s.items, id)
+}
+
+func (s *photoStore) Get(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[id]
+	if !ok || time.Now().After(e.expires) {
+		s.remove(id)
+		return nil, false
+	}
+	return e.raw, true
+}
+
+// photoResponse is the "photo" block of a decode response.
+type photoResponse struct {
+	ID  string `json:"id,omitempty"`
+	URL string `json:"url,omitempty"`
+	*utils.Photo
+}
+
+// describePhoto stores raw and converts it to the requested format. A
+// photo that cannot be decoded is still reported with its source format
+// and dimensions so the client can fetch the original bytes; one that
+// cannot be stored comes back without an ID and URL.
+func (h *QRHandler) describePhoto(raw []byte, format string) *photoResponse {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	resp := &photoResponse{}
+	if id, err := h.Photos.Put(raw); err != nil {
+		log.Println("PHOTO WARNING: not stored:", err)
+	} else {
+		resp.ID, resp.URL = id, "/decode/"+id+"/photo"
+	}
+	photo, err := utils.ConvertPhoto(raw, format)
+	if err != nil {
+		log.Println("PHOTO WARNING: conversion failed:", err)
+	}
+	resp.Photo = photo
+	return resp
+}
+
+// Photo serves a photo from a previous decode. ?format=png|jpeg re-encodes
+// it (png by default), ?format=raw returns the embedded bytes unchanged.
+// Re-encoding a JPEG2000 photo needs a build with the openjpeg tag and
+// cgo. Without it the original bytes are served as image/jp2 when no
+// format was asked for or the client accepts that type; an explicit
+// png/jpeg request gets 422.
+func (h *QRHandler) Photo(c *gin.Context) {
+	raw, ok := h.Photos.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "photo not found or expired"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "png")
+	if format == "raw" {
+		c.Data(http.StatusOK, rawPhotoMime(raw), raw)
+		return
+	}
+
+	img, err := utils.DecodeImage(raw)
+	if errors.Is(err, utils.ErrJPEG2000Unsupported) {
+		mime := rawPhotoMime(raw)
+		if c.Query("format") == "" || strings.Contains(c.GetHeader("Accept"), mime) {
+			log.Println("PHOTO WARNING: JPEG2000 decoding not built in, serving", mime)
+			c.Data(http.StatusOK, mime, raw)
+			return
+		}
+		err = fmt.Errorf("%v; rebuild with -tags openjpeg or request ?format=raw", err)
+	}
+	if err != nil {
+		log.Println("PHOTO ERROR: decode failed:", err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	out, mime, err := utils.EncodePhoto(img, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, mime, out)
+}
+
+// rawPhotoMime is the content type of the embedded photo bytes.
+func rawPhotoMime(raw []byte) string {
+	if f, ok := utils.SniffJP2(raw); ok {
+		return "image/" + f
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Aashish23092/aadhaar-qr-service/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPhotoStore(t *testing.T) {
+	s := newPhotoStore(time.Minute)
+	s.maxEntries, s.maxBytes = 3, 100
+
+	photo := func(n int, b byte) []byte { return bytes.Repeat([]byte{b}, n) }
+	put := func(raw []byte) string {
+		t.Helper()
+		id, err := s.Put(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	a, b, c := put(photo(10, 'a')), put(photo(10, 'b')), put(photo(10, 'c'))
+	if a == b || b == c || len(a) != 32 {
+		t.Fatalf("bad IDs %q %q %q", a, b, c)
+	}
+
+	// A fourth entry evicts the oldest.
+	d := put(photo(10, 'd'))
+	if _, ok := s.Get(a); ok {
+		t.Error("oldest photo kept past the entry cap")
+	}
+	for _, id := range []string{b, c, d} {
+		if _, ok := s.Get(id); !ok {
+			t.Errorf("photo %s evicted early", id)
+		}
+	}
+
+	// So does one that would exceed the byte cap, as many as needed.
+	e := put(photo(85, 'e'))
+	for _, id := range []string{b, c} {
+		if _, ok := s.Get(id); ok {
+			t.Errorf("photo %s kept past the byte cap", id)
+		}
+	}
+	if raw, ok := s.Get(e); !ok || !bytes.Equal(raw, photo(85, 'e')) {
+		t.Error("newest photo missing")
+	}
+	if s.size != 95 || len(s.items) != 2 {
+		t.Errorf("store holds %d photos, %d bytes; want 2, 95", len(s.items), s.size)
+	}
+
+	if _, err := s.Put(photo(101, 'f')); err == nil {
+		t.Error("photo larger than the store accepted")
+	}
+
+	// Expired photos are gone.
+	s.items[d] = photoEntry{raw: s.items[d].raw, expires: time.Now().Add(-time.Second)}
+	if _, ok := s.Get(d); ok {
+		t.Error("expired photo returned")
+	}
+	if s.size != 85 {
+		t.Errorf("size = %d after expiry, want 85", s.size)
+	}
+}
+
+func TestPhotoWithoutJPEG2000Decoder(t *testing.T) {
+	// A J2K codestream header; its pixels are never decoded.
+	raw := []byte{0xFF, 0x4F, 0xFF, 0x51, 0x00, 0x29, 0x00, 0x00}
+	if _, err := utils.DecodeJPEG2000(raw); !errors.Is(err, utils.ErrJPEG2000Unsupported) {
+		t.Skip("built with a JPEG2000 decoder")
+	}
+
+	gin.SetMode(gin.TestMode)
+	h := &QRHandler{Photos: newPhotoStore(time.Minute)}
+	id, err := h.Photos.Put(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/decode/:id/photo", h.Photo)
+
+	tests := []struct {
+		name     string
+		query    string
+		accept   string
+		wantCode int
+	}{
+		{"default format serves the original", "", "", http.StatusOK},
+		{"raw", "?format=raw", "", http.StatusOK},
+		{"explicit png", "?format=png", "", http.StatusUnprocessableEntity},
+		{"explicit png, client accepts J2K", "?format=png", "image/png, image/j2k", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/decode/"+id+"/photo"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if w.Code == http.StatusOK && (w.Header().Get("Content-Type") != "image/j2k" || !bytes.Equal(w.Body.Bytes(), raw)) {
+				t.Errorf("got %s %x", w.Header().Get("Content-Type"), w.Body.Bytes())
+			}
+		})
+	}
+}
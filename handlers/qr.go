@@ -1,256 +1,216 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"crypto/rsa"
-	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
-	"io"
+	"errors"
 	"log"
-	"math/big"
+	"mime/multipart"
 	"net/http"
+	"time"
 
+	"github.com/Aashish23092/aadhaar-qr-service/pkg/aadhaarqr"
 	"github.com/Aashish23092/aadhaar-qr-service/services"
 	"github.com/Aashish23092/aadhaar-qr-service/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/makiuchi-d/gozxing"
-	"github.com/makiuchi-d/gozxing/qrcode"
 )
 
 type QRHandler struct {
 	PublicKey *rsa.PublicKey
+	Decoders  *utils.DecoderRegistry
+	Photos    *photoStore
+	// Timeouts bound each /decode request; zero is unlimited.
+	Timeouts aadhaarqr.Timeouts
+	// Mode is the default decode mode, overridden by ?mode=.
+	Mode    aadhaarqr.Mode
+	Workers int
 }
 
-func NewQRHandler(pub *rsa.PublicKey) *QRHandler {
-	return &QRHandler{PublicKey: pub}
-}
-
-func decodeImage(fileBytes []byte) (image.Image, error) {
-	if img, err := png.Decode(bytes.NewReader(fileBytes)); err == nil {
-		return img, nil
-	}
-	if img, err := jpeg.Decode(bytes.NewReader(fileBytes)); err == nil {
-		return img, nil
+func NewQRHandler(pub *rsa.PublicKey, decoders *utils.DecoderRegistry) *QRHandler {
+	if decoders == nil {
+		decoders = utils.DefaultDecoders
 	}
-	return nil, fmt.Errorf("unsupported image format")
+	return &QRHandler{PublicKey: pub, Decoders: decoders, Photos: newPhotoStore(photoTTL)}
 }
 
-func decodeQRZXing(img image.Image) ([]byte, error) {
-	log.Println("[ZX] STEP A: Starting decodeQRZXing")
-	log.Printf("[ZX] Image bounds → %v\n", img.Bounds())
-
-	// 1. Create luminance source
-	source := gozxing.NewLuminanceSourceFromImage(img)
-	if source == nil {
-		log.Println("[ZX] ERROR: Luminance source is nil")
-		return nil, fmt.Errorf("luminance source is nil")
-	}
-	log.Printf("[ZX] STEP B: Luminance source created (%dx%d)\n",
-		source.GetWidth(), source.GetHeight())
-
-	// 2. Binarizer
-	binarizer := gozxing.NewHybridBinarizer(source)
-	if binarizer == nil {
-		log.Println("[ZX] ERROR: HybridBinarizer returned nil")
-		return nil, fmt.Errorf("hybrid binarizer nil")
+func (h *QRHandler) Decode(c *gin.Context) {
+	mode := h.Mode
+	if v := c.Query("mode"); v != "" {
+		m, err := aadhaarqr.ParseMode(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		mode = m
 	}
-	log.Println("[ZX] STEP C: Hybrid binarizer OK")
 
-	// 3. Binary bitmap
-	bmp, err := gozxing.NewBinaryBitmap(binarizer)
-	if err != nil {
-		log.Printf("[ZX] STEP D ERROR: Binary bitmap creation failed → %v\n", err)
-		return nil, fmt.Errorf("binary bitmap error: %v", err)
+	file, opts, ok := h.decodeRequest(c)
+	if !ok {
+		return
 	}
-	log.Println("[ZX] STEP D: Binary bitmap created")
-
-	// 4. ZXing QR decode
-	reader := qrcode.NewQRCodeReader()
-	log.Println("[ZX] STEP E: Attempting ZXing decode…")
+	defer file.Close()
+	opts.Mode = mode
+	opts.Workers = h.Workers
 
-	result, err := reader.Decode(bmp, nil)
+	res, err := aadhaarqr.Decode(c.Request.Context(), file, opts)
 	if err != nil {
-		log.Printf("[ZX] STEP F ERROR: ZXing decode failed → %v\n", err)
-		return nil, fmt.Errorf("QR decode error: %v", err)
+		h.decodeError(c, err)
+		return
 	}
 
-	if result == nil {
-		log.Println("[ZX] STEP F ERROR: ZXing returned nil result")
-		return nil, fmt.Errorf("nil result from reader.Decode()")
+	resp := h.resultJSON(res, c.Query("photo_format"))
+	if res.Exif != nil {
+		resp["exif"] = res.Exif
 	}
-
-	text := result.GetText()
-	log.Printf("[ZX] STEP G: ZXing decode SUCCESS, length=%d\n", len(text))
-
-	return []byte(text), nil
+	c.JSON(http.StatusOK, resp)
 }
 
-func (h *QRHandler) Decode(c *gin.Context) {
-	file, _, err := c.Request.FormFile("file")
-	if err != nil {
-		log.Println("STEP 1 ERROR: No file in request:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file missing"})
+// DecodeAll decodes every QR code in the upload, e.g. all the codes on an
+// Aadhaar letter or a sheet of cards, and returns one entry per code.
+// Unlike /decode it runs the decoders only, without the OpenCV or WeChat
+// detectors.
+func (h *QRHandler) DecodeAll(c *gin.Context) {
+	file, opts, ok := h.decodeRequest(c)
+	if !ok {
 		return
 	}
-	log.Println("STEP 1: File received successfully")
 	defer file.Close()
 
-	fileBytes, err := io.ReadAll(file)
-	if err != nil {
-		log.Println("STEP 2 ERROR: Unable to read file bytes:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
-		return
-	}
-	log.Println("STEP 2: File read OK, size:", len(fileBytes))
-
-	img, err := decodeImage(fileBytes)
+	results, err := aadhaarqr.DecodeAll(c.Request.Context(), file, opts)
 	if err != nil {
-		log.Println("STEP 3 ERROR: decodeImage failed:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image"})
+		h.decodeError(c, err)
 		return
 	}
-	log.Println("STEP 3: Image decoded successfully")
-
-	// ========================================================
-	// STEP 4: Multi-stage QR Decoding Pipeline
-	// ========================================================
-	var qrBytes []byte
-	var decodeErr error
 
-	// Stage 1: OpenCV QR Detection & Cropping
-	log.Println("STEP 4A: Attempting OpenCV QR detection and cropping...")
-	croppedImg, detectErr := utils.DetectAndCropQR(img)
-	if detectErr != nil {
-		log.Printf("STEP 4A WARNING: OpenCV detection failed: %v, using original image\n", detectErr)
-		croppedImg = img // Fallback to original
-	} else {
-		log.Println("STEP 4A SUCCESS: QR detected and cropped")
+	items := make([]gin.H, len(results))
+	for i, res := range results {
+		if res.Err != nil {
+			item := gin.H{"error": res.Err.Error(), "decode": res.Decode}
+			var parseErr *aadhaarqr.ParseError
+			if errors.As(res.Err, &parseErr) {
+				item["format"] = parseErr.Format
+			}
+			items[i] = item
+			continue
+		}
+		items[i] = h.resultJSON(res, c.Query("photo_format"))
 	}
 
-	// Stage 2: Try quirc decoder first
-	log.Println("STEP 4B: Attempting quirc decode...")
-	qrBytes, decodeErr = utils.DecodeWithQuirc(croppedImg)
-	if decodeErr == nil && len(qrBytes) > 0 {
-		log.Printf("STEP 4B SUCCESS: quirc decoded %d bytes\n", len(qrBytes))
-		goto DECODE_SUCCESS
+	resp := gin.H{
+		"count":   len(items),
+		"results": items,
 	}
-	log.Printf("STEP 4B FAILED: quirc decode error: %v\n", decodeErr)
-
-	// Stage 3: Try ZBar decoder
-	log.Println("STEP 4C: Attempting ZBar decode...")
-	qrBytes, decodeErr = utils.DecodeWithZBar(croppedImg)
-	if decodeErr == nil && len(qrBytes) > 0 {
-		log.Printf("STEP 4C SUCCESS: ZBar decoded %d bytes\n", len(qrBytes))
-		goto DECODE_SUCCESS
+	if len(results) > 0 && results[0].Exif != nil {
+		resp["exif"] = results[0].Exif
 	}
-	log.Printf("STEP 4C FAILED: ZBar decode error: %v\n", decodeErr)
+	c.JSON(http.StatusOK, resp)
+}
 
-	// Stage 4: Final fallback to ZXing
-	log.Println("STEP 4D: Attempting ZXing decode (final fallback)...")
-	qrBytes, decodeErr = decodeQRZXing(croppedImg)
-	if decodeErr != nil {
-		log.Println("STEP 4D ERROR: All decoders failed")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "QR not detected by any decoder"})
-		return
+// decodeRequest reads the uploaded file and the options shared by the
+// decode endpoints, writing the error response itself when they are
+// invalid.
+func (h *QRHandler) decodeRequest(c *gin.Context) (multipart.File, aadhaarqr.Options, bool) {
+	// ?as_of=YYYY-MM-DD sets the date ages are computed at.
+	var ageAsOf time.Time
+	if v := c.Query("as_of"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "as_of must be YYYY-MM-DD"})
+			return nil, aadhaarqr.Options{}, false
+		}
+		ageAsOf = t
 	}
-	log.Printf("STEP 4D SUCCESS: ZXing decoded %d bytes\n", len(qrBytes))
-
-DECODE_SUCCESS:
-	log.Println("STEP 4: QR decoded successfully, byte-length:", len(qrBytes))
 
-	fmt.Println("QR bytes extracted:", len(qrBytes))
-
-	//---------------------------------------------------------
-	// 1️⃣ Try Secure QR v2 first
-	//---------------------------------------------------------
-	log.Println("STEP 5: Attempting ParseSecureQR (v2)...")
-	if secureQR, err := services.ParseSecureQR(qrBytes, h.PublicKey); err == nil {
-		log.Println("STEP 5 SUCCESS: Secure QR v2 decoded")
-		c.JSON(http.StatusOK, gin.H{
-			"type": "secure_qr_v2",
-			"data": secureQR,
-		})
-		return
-	} else {
-		log.Println("STEP 5 FAILED: v2 parse error:", err)
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		log.Println("STEP 1 ERROR: No file in request:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file missing"})
+		return nil, aadhaarqr.Options{}, false
 	}
+	log.Println("STEP 1: File received successfully")
 
-	//---------------------------------------------------------
-	// 2️⃣ Check Secure QR v1
-	//---------------------------------------------------------
-	log.Println("STEP 6: Checking if QR is numeric:", isNumeric(qrBytes), "length:", len(qrBytes))
-	//---------------------------------------------------------
-	// 3️⃣ Check Secure QR v5
-	//---------------------------------------------------------
-	// 2️⃣ Secure QR v5 / v1 → numeric payload
-	if isNumeric(qrBytes) && len(qrBytes) > 500 {
+	return file, aadhaarqr.Options{
+		PublicKey:   h.PublicKey,
+		Decoders:    h.Decoders,
+		PDFPassword: c.PostForm("password"),
+		RevealUID:   c.Query("reveal_uid") == "true",
+		AgeAsOf:     ageAsOf,
+		Timeouts:    h.Timeouts,
+	}, true
+}
 
-		// First try V5 (gzip + V5...)
-		log.Println("STEP 7: Attempting ParseSecureQRV5 (v5)...")
-		if v5, err := services.ParseSecureQRV5(qrBytes); err == nil {
-			log.Println("STEP 7 SUCCESS: Secure QR v5 decoded")
-			c.JSON(http.StatusOK, gin.H{
-				"type": "secure_qr_v5",
-				"data": v5,
-			})
-			return
+// resultJSON renders one decoded QR for a response.
+func (h *QRHandler) resultJSON(res *aadhaarqr.Result, photoFormat string) gin.H {
+	// Plain text QRs keep their original response shape.
+	if res.Format.Format == services.FormatPlainText {
+		resp := gin.H{
+			"type":     res.Type,
+			"raw_text": string(res.Payload),
+			"format":   res.Format,
+			"decode":   res.Decode,
 		}
-		log.Println("STEP 7 FAILED: v5 parse error")
-
-		// Fallback: try old V1 (if you still need it)
-		if v1, err := services.ParseSecureQRV1(qrBytes, nil); err == nil {
-			c.JSON(http.StatusOK, gin.H{
-				"type": "secure_qr_v1",
-				"data": v1,
-			})
-			return
+		if res.Consensus != nil {
+			resp["consensus"] = res.Consensus
 		}
+		return resp
+	}
 
-		// If both fail
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "secure_qr_vx decode failed",
-		})
-		return
+	resp := gin.H{
+		"type":   res.Type,
+		"data":   res.Data,
+		"format": res.Format,
+		"decode": res.Decode,
 	}
-	//---------------------------------------------------------
-	// 3️⃣ Old QR (plain text)
-	//---------------------------------------------------------
-	if len(qrBytes) < 500 {
-		c.JSON(http.StatusOK, gin.H{
-			"type":     "old_qr",
-			"raw_text": string(qrBytes),
-		})
-		return
+	if res.Consensus != nil {
+		resp["consensus"] = res.Consensus
 	}
-
-	//---------------------------------------------------------
-	// 4️⃣ Unknown format
-	//---------------------------------------------------------
-	c.JSON(http.StatusBadRequest, gin.H{
-		"error": "unrecognized Aadhaar QR format",
-	})
-
-	// Debug fallback
-	bi := new(big.Int)
-	bi.SetString(string(qrBytes), 10)
-	b := bi.Bytes()
-
-	limit := 32
-	if len(b) < limit {
-		limit = len(b)
+	if photo := h.describePhoto(res.Photo, photoFormat); photo != nil {
+		resp["photo"] = photo
 	}
-
-	fmt.Printf("HEX: %x\n", b[:limit])
-	fmt.Printf("ASCII: %s\n", b[:limit])
+	return resp
 }
 
-func isNumeric(b []byte) bool {
-	for _, ch := range b {
-		if ch < '0' || ch > '9' {
-			return false
-		}
+// decodeError maps aadhaarqr.Decode errors to responses.
+func (h *QRHandler) decodeError(c *gin.Context, err error) {
+	var imgErr *aadhaarqr.ImageError
+	var parseErr *aadhaarqr.ParseError
+	var unsupported *utils.UnsupportedFormatError
+	var timeout *aadhaarqr.TimeoutError
+	switch {
+	case errors.As(err, &timeout):
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": err.Error(),
+			"stage": timeout.Stage,
+		})
+	case errors.Is(err, context.DeadlineExceeded):
+		// A deadline on the request context rather than a Timeouts budget.
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+	case errors.Is(err, context.Canceled):
+		// The client went away; nobody reads the response.
+		log.Println("DECODE: request cancelled:", err)
+		c.AbortWithStatus(499)
+	case errors.Is(err, utils.ErrPDFPasswordRequired) || errors.Is(err, utils.ErrPDFBadPassword):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":             err.Error(),
+			"password_required": true,
+		})
+	case errors.Is(err, utils.ErrPDFNoImages):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.As(err, &unsupported):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":        unsupported.Error(),
+			"image_format": unsupported.Format,
+		})
+	case errors.As(err, &imgErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image"})
+	case errors.Is(err, aadhaarqr.ErrNoQR):
+		c.JSON(http.StatusBadRequest, gin.H{"error": aadhaarqr.ErrNoQR.Error()})
+	case errors.As(err, &parseErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  parseErr.Error(),
+			"format": parseErr.Format,
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
 	}
-	return true
 }
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Aashish23092/aadhaar-qr-service/pkg/aadhaarqr"
+	"github.com/gin-gonic/gin"
+)
+
+func TestDecodeErrorStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"stage budget", &aadhaarqr.TimeoutError{Stage: aadhaarqr.StageDecode, Budget: time.Second}, http.StatusGatewayTimeout},
+		{"request deadline", context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{"wrapped request deadline", fmt.Errorf("load: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"client cancelled", context.Canceled, 499},
+		{"wrapped cancel", fmt.Errorf("decode: %w", context.Canceled), 499},
+		{"no QR", aadhaarqr.ErrNoQR, http.StatusBadRequest},
+		{"other", errors.New("boom"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			(&QRHandler{}).decodeError(c, tt.err)
+			c.Writer.WriteHeaderNow()
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
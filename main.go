@@ -1,11 +1,16 @@
 package main
 
 import (
+	"expvar"
 	"log"
+	"net/http"
+	"os"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/Aashish23092/aadhaar-qr-service/handlers"
+	"github.com/Aashish23092/aadhaar-qr-service/pkg/aadhaarqr"
 	"github.com/Aashish23092/aadhaar-qr-service/utils"
 )
 
@@ -15,10 +20,64 @@ func main() {
 		log.Fatal("Failed loading public key:", err)
 	}
 
+	// QR_DECODERS reorders/toggles decoders, e.g. "zxing,quirc,-zbar"
+	if spec := os.Getenv("QR_DECODERS"); spec != "" {
+		utils.DefaultDecoders.Configure(spec)
+	}
+	log.Println("QR decoders enabled:", utils.DefaultDecoders.Names())
+
+	if name := os.Getenv("QR_DETECTOR"); name != "" {
+		if err := utils.SetDetector(name); err != nil {
+			log.Fatal("Invalid QR_DETECTOR:", err, " available:", utils.DetectorNames())
+		}
+	}
+	// e.g. QR_PDF_RENDERER=pdftoppm to also rasterize PDF pages
+	if name := os.Getenv("QR_PDF_RENDERER"); name != "" {
+		if err := utils.SetPageRenderer(name); err != nil {
+			log.Fatal("Invalid QR_PDF_RENDERER:", err)
+		}
+	}
+
 	r := gin.Default()
-	handler := handlers.NewQRHandler(pub)
+	handler := handlers.NewQRHandler(pub, utils.DefaultDecoders)
+
+	// e.g. QR_TIMEOUTS="overall=20s,decode=10s"
+	if spec := os.Getenv("QR_TIMEOUTS"); spec != "" {
+		timeouts, err := aadhaarqr.ParseTimeouts(spec)
+		if err != nil {
+			log.Fatal("Invalid QR_TIMEOUTS:", err)
+		}
+		handler.Timeouts = timeouts
+	}
+	// QR_DECODE_MODE=race runs decoders concurrently on QR_WORKERS workers;
+	// consensus runs all of them and compares their payloads
+	mode, err := aadhaarqr.ParseMode(os.Getenv("QR_DECODE_MODE"))
+	if err != nil {
+		log.Fatal("Invalid QR_DECODE_MODE:", err)
+	}
+	handler.Mode = mode
+	if v := os.Getenv("QR_WORKERS"); v != "" {
+		if handler.Workers, err = strconv.Atoi(v); err != nil || handler.Workers < 1 {
+			log.Fatal("Invalid QR_WORKERS: ", v)
+		}
+	}
 
 	r.POST("/decode", handler.Decode)
+	r.POST("/decode/all", handler.DecodeAll)
+	r.GET("/decode/:id/photo", handler.Photo)
+	r.POST("/verify/contact", handler.VerifyContact)
+	r.POST("/offline-kyc", handler.OfflineKYC)
+	// expvar counters, e.g. qr_consensus disagreements, are served only
+	// when asked for and on their own listener, e.g.
+	// QR_DEBUG_ADDR=127.0.0.1:6060
+	if addr := os.Getenv("QR_DEBUG_ADDR"); addr != "" {
+		debug := http.NewServeMux()
+		debug.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			log.Fatal("Debug listener: ", http.ListenAndServe(addr, debug))
+		}()
+		log.Println("Serving /debug/vars on", addr)
+	}
 
 	r.Run(":8080")
 }
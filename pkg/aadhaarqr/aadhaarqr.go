@@ -0,0 +1,270 @@
+// Package aadhaarqr runs the Aadhaar QR pipeline without the HTTP server:
+// image/PDF loading, QR detection, the decoder chain, format detection and
+// parsing. The /decode handler is a thin adapter over Decode.
+package aadhaarqr
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/Aashish23092/aadhaar-qr-service/services"
+	"github.com/Aashish23092/aadhaar-qr-service/utils"
+)
+
+// ErrNoQR is returned when no page of the input yields a QR payload.
+var ErrNoQR = errors.New("QR not detected by any decoder")
+
+// ImageError wraps failures to load the input as an image. Err may be one
+// of the utils PDF errors or a *utils.UnsupportedFormatError.
+type ImageError struct {
+	Err error
+}
+
+func (e *ImageError) Error() string { return e.Err.Error() }
+func (e *ImageError) Unwrap() error { return e.Err }
+
+// ParseError is returned when a QR was decoded but its payload could not
+// be parsed; Format is what the payload was detected as.
+type ParseError struct {
+	Format services.FormatInfo
+	Err    error
+}
+
+func (e *ParseError) Error() string { return e.Err.Error() }
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Options configure Decode. The zero value uses the default decoder chain
+// and has no key, so signed payloads parse but are reported unverified.
+type Options struct {
+	// PublicKey is the UIDAI key Secure QR and XML signatures are checked
+	// against; with nil, signed payloads still parse and every signature
+	// is reported invalid.
+	PublicKey *rsa.PublicKey
+	// Decoders is the decoder chain; nil means utils.DefaultDecoders.
+	Decoders *utils.DecoderRegistry
+	// PDFPassword opens password-protected e-Aadhaar PDFs.
+	PDFPassword string
+	// RevealUID returns full Aadhaar numbers instead of masking them.
+	RevealUID bool
+	// AgeAsOf is the reference date for ages; zero means now.
+	AgeAsOf time.Time
+	// Timeouts bound the stages and the whole call; see TimeoutError.
+	Timeouts Timeouts
+	// Mode is ModeSequential (the default), ModeRace or ModeConsensus.
+	Mode Mode
+	// Workers bounds concurrent decoder calls in ModeRace; zero means
+	// one per CPU.
+	Workers int
+}
+
+// Result is a decoded and parsed QR.
+type Result struct {
+	// Type is the response type, e.g. "secure_qr_v4" or "old_qr" for plain
+	// text (services.FormatPlainText).
+	Type   string
+	Format services.FormatInfo
+	// Data is the parser's model, e.g. *services.SecureQRV5.
+	Data interface{}
+	// Payload is the raw QR content.
+	Payload []byte
+	// Photo is the resident photo as carried by the payload, if any.
+	Photo []byte
+
+	ImageFormat string
+	Decode      *utils.DecodeResult
+	Exif        *utils.ExifInfo
+	// Consensus is set in ModeConsensus.
+	Consensus *Consensus
+	// Err is set by DecodeAll, instead of the parsed fields, when this
+	// code's payload could not be parsed; it is a *ParseError.
+	Err error
+}
+
+// Decode reads an image, PDF or other supported file from r and returns
+// the first QR it finds, parsed. Cancelling ctx stops the pipeline between
+// stages, decoders and image variants.
+func Decode(ctx context.Context, r io.Reader, opts Options) (*Result, error) {
+	ctx, cancel := withBudget(ctx, StageOverall, opts.Timeouts.Overall)
+	defer cancel()
+
+	if opts.Mode == "" {
+		opts.Mode = ModeSequential
+	}
+	loaded, err := load(ctx, r, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// ========================================================
+	// STEP 4: Multi-stage QR Decoding Pipeline, page by page
+	// ========================================================
+	decodeCtx, cancelDecode := withBudget(ctx, StageDecode, opts.Timeouts.Decode)
+	defer cancelDecode()
+
+	var decoded *utils.DecodeResult
+	var report *Consensus
+	decodeErr := errors.New("no image pages")
+	for i, page := range loaded.Pages {
+		if len(loaded.Pages) > 1 {
+			log.Printf("STEP 4: Trying page %d of %d\n", i+1, len(loaded.Pages))
+		}
+		decoded, report, decodeErr = decodeQR(decodeCtx, page, opts)
+		if decodeErr == nil {
+			if len(loaded.Pages) > 1 {
+				decoded.Page = i + 1
+			}
+			break
+		}
+		if isContextError(decodeErr) {
+			log.Println("STEP 4 ERROR: Decoding stopped:", decodeErr)
+			return nil, decodeErr
+		}
+	}
+	if decodeErr != nil {
+		log.Println("STEP 4B ERROR: All decoders failed:", decodeErr)
+		return nil, fmt.Errorf("%w: %v", ErrNoQR, decodeErr)
+	}
+	log.Printf("STEP 4: QR decoded successfully by %s (variant %s, transform %s), byte-length: %d\n",
+		decoded.Decoder, decoded.Variant, decoded.Transform, len(decoded.Payload))
+
+	res, err := runStage(ctx, StageParse, opts.Timeouts.Parse, func(context.Context) (*Result, error) {
+		return parse(decoded.Payload, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.ImageFormat = loaded.Format
+	res.Decode = decoded
+	res.Exif = loaded.Exif
+	res.Consensus = report
+	return res, nil
+}
+
+// load reads r and loads it as one or more image pages, filling in the
+// default decoder chain.
+func load(ctx context.Context, r io.Reader, opts *Options) (*utils.LoadedImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		log.Println("STEP 2 ERROR: Unable to read file bytes:", err)
+		return nil, err
+	}
+	log.Println("STEP 2: File read OK, size:", len(data))
+	if opts.Decoders == nil {
+		opts.Decoders = utils.DefaultDecoders
+	}
+
+	loaded, err := runStage(ctx, StageLoad, opts.Timeouts.Load, func(context.Context) (*utils.LoadedImage, error) {
+		return utils.LoadImage(data, utils.LoadOptions{PDFPassword: opts.PDFPassword})
+	})
+	if err != nil {
+		log.Println("STEP 3 ERROR: LoadImage failed:", err)
+		if isContextError(err) {
+			return nil, err
+		}
+		return nil, &ImageError{Err: err}
+	}
+	log.Printf("STEP 3: Image decoded successfully (%s, %d page(s))\n", loaded.Format, len(loaded.Pages))
+	return loaded, nil
+}
+
+// isContextError reports whether err means the pipeline was stopped
+// rather than that the input was bad.
+func isContextError(err error) bool {
+	return errors.Is(err, ErrTimeout) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// parse classifies a QR payload and hands it to the matching parser.
+func parse(payload []byte, opts Options) (*Result, error) {
+	//---------------------------------------------------------
+	// STEP 5: Classify the payload, then parse it
+	//---------------------------------------------------------
+	parsed, err := services.Parse(payload, opts.PublicKey, services.ParseOptions{
+		RevealUID: opts.RevealUID,
+		AgeAsOf:   opts.AgeAsOf,
+	})
+	info := parsed.Info
+	log.Printf("STEP 5: Detected format %s %s (confidence %.2f): %s\n",
+		info.Format, info.Version, info.Confidence, info.Reason)
+	if err != nil {
+		log.Printf("STEP 6 ERROR: %s parse failed: %v\n", info.Format, err)
+		if info.Format == services.FormatUnknown {
+			logPayloadPrefix(payload)
+		}
+		return nil, &ParseError{Format: info, Err: err}
+	}
+	log.Println("STEP 6 SUCCESS: parsed as", parsed.Type)
+
+	return &Result{
+		Type:    parsed.Type,
+		Format:  parsed.Info,
+		Data:    parsed.Data,
+		Payload: payload,
+		Photo:   parsed.Photo,
+	}, nil
+}
+
+// decodeQR runs detection and the decoder chain on one image.
+func decodeQR(ctx context.Context, img image.Image, opts Options) (*utils.DecodeResult, *Consensus, error) {
+	// Stage 1: QR Detection & Cropping
+	log.Println("STEP 4A: Attempting QR detection and cropping...")
+	croppedImg := img
+	detection, detectErr := runStage(ctx, StageDetect, opts.Timeouts.Detect, func(context.Context) (*utils.Detection, error) {
+		return utils.DetectQR(img)
+	})
+	if isContextError(detectErr) {
+		return nil, nil, detectErr
+	}
+	if detectErr != nil {
+		log.Printf("STEP 4A WARNING: QR detection failed: %v, using original image\n", detectErr)
+	} else {
+		log.Printf("STEP 4A SUCCESS: QR detected by %s at %v\n", detection.Detector, detection.Corners)
+		croppedImg = detection.Image
+	}
+
+	// Stage 2: Run the configured decoder chain over preprocessed,
+	// rescaled and rotated variants; fall back to the full image if the
+	// crop does not decode.
+	log.Printf("STEP 4B: Running decoder chain %v (%s)\n", opts.Decoders.Names(), opts.Mode)
+	decoded, report, decodeErr := search(ctx, croppedImg, opts)
+	if isContextError(decodeErr) {
+		return nil, nil, decodeErr
+	}
+	if decodeErr != nil && croppedImg != img {
+		log.Println("STEP 4B WARNING: crop did not decode, retrying on the full image:", decodeErr)
+		decoded, report, decodeErr = search(ctx, img, opts)
+		if isContextError(decodeErr) {
+			return nil, nil, decodeErr
+		}
+	}
+	if decodeErr != nil && detection != nil && len(detection.Payload) > 0 {
+		// Some detectors (OpenCV) decode as a side effect of detection.
+		log.Println("STEP 4B WARNING: decoder chain failed, using payload from detector", detection.Detector)
+		decoded, decodeErr = &utils.DecodeResult{Payload: detection.Payload, Decoder: detection.Detector}, nil
+	}
+	return decoded, report, decodeErr
+}
+
+// logPayloadPrefix dumps the start of an unrecognized numeric payload to
+// help identify new formats.
+func logPayloadPrefix(qrBytes []byte) {
+	bi := new(big.Int)
+	if _, ok := bi.SetString(string(qrBytes), 10); !ok {
+		return
+	}
+	b := bi.Bytes()
+
+	limit := 32
+	if len(b) < limit {
+		limit = len(b)
+	}
+
+	fmt.Printf("HEX: %x\n", b[:limit])
+	fmt.Printf("ASCII: %s\n", b[:limit])
+}
@@ -0,0 +1,73 @@
+package aadhaarqr
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image/png"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+
+	"github.com/Aashish23092/aadhaar-qr-service/services"
+)
+
+// qrPNG encodes payload byte for byte into a QR code image.
+func qrPNG(t *testing.T, payload []byte) []byte {
+	t.Helper()
+	runes := make([]rune, len(payload))
+	for i, b := range payload {
+		runes[i] = rune(b)
+	}
+	hints := map[gozxing.EncodeHintType]interface{}{
+		gozxing.EncodeHintType_CHARACTER_SET: "ISO-8859-1",
+	}
+	m, err := qrcode.NewQRCodeWriter().Encode(string(runes), gozxing.BarcodeFormat_QR_CODE, 600, 600, hints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// binarySecureQR lays out a version 2 binary Secure QR payload around xml
+// with an all-zero signature.
+func binarySecureQR(xml string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(2))
+	binary.Write(&b, binary.LittleEndian, uint16(0))
+	binary.Write(&b, binary.LittleEndian, uint32(len(xml)))
+	b.WriteString(xml)
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	b.Write(make([]byte, 256))
+	return b.Bytes()
+}
+
+// TestDecodeZeroOptions decodes a signed payload without a key in every
+// mode: it must parse and come back unverified.
+func TestDecodeZeroOptions(t *testing.T) {
+	img := qrPNG(t, binarySecureQR(`<OfflinePaperlessKyc referenceId="123420240101120000123"><UidData><Poi name="Test Resident" dob="01-01-1990" gender="F"/></UidData></OfflinePaperlessKyc>`))
+
+	for _, mode := range []Mode{"", ModeRace, ModeConsensus} {
+		t.Run(string(mode), func(t *testing.T) {
+			res, err := Decode(context.Background(), bytes.NewReader(img), Options{Mode: mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, ok := res.Data.(*services.AadhaarSecureQR)
+			if !ok {
+				t.Fatalf("Data is %T, want *services.AadhaarSecureQR", res.Data)
+			}
+			if q.Valid {
+				t.Error("signature reported valid without a key")
+			}
+			if q.Name != "Test Resident" {
+				t.Errorf("Name = %q", q.Name)
+			}
+		})
+	}
+}
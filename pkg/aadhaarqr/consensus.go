@@ -0,0 +1,152 @@
+package aadhaarqr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"image"
+	"log"
+	"sort"
+
+	"github.com/Aashish23092/aadhaar-qr-service/services"
+	"github.com/Aashish23092/aadhaar-qr-service/utils"
+)
+
+// consensusStats counts consensus runs on /debug/vars: runs, agreed,
+// disagreed, single (only one decoder read the code), and per decoder
+// outvoted_<name> and failed_<name>.
+var consensusStats = expvar.NewMap("qr_consensus")
+
+// Consensus reports how the decoders' payloads compared in
+// ModeConsensus.
+type Consensus struct {
+	// Agreed is set when every decoder that read the code read the same
+	// bytes.
+	Agreed     bool                 `json:"agreed"`
+	Candidates []ConsensusCandidate `json:"candidates"`
+	// Failed maps decoders that read nothing to their error.
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// ConsensusCandidate is one distinct payload and the decoders that read
+// it.
+type ConsensusCandidate struct {
+	Decoders []string `json:"decoders"`
+	Length   int      `json:"length"`
+	SHA256   string   `json:"sha256"`
+	// Type is the parsed response type; empty if the payload does not
+	// parse.
+	Type     string `json:"type,omitempty"`
+	Signed   bool   `json:"signed"`
+	Verified bool   `json:"verified"`
+	Chosen   bool   `json:"chosen"`
+	// FirstDiff is the first byte offset at which the payload differs
+	// from the chosen one.
+	FirstDiff *int `json:"first_diff,omitempty"`
+
+	result *utils.DecodeResult
+	rank   int
+}
+
+// consensus decodes img with every decoder and picks a payload:
+// signature-verified first, then payloads that parse, then the one most
+// decoders agree on, then decoder order.
+func consensus(ctx context.Context, img image.Image, opts Options) (*utils.DecodeResult, *Consensus, error) {
+	found, failed, err := opts.Decoders.DecodeEach(ctx, img, utils.DefaultPreprocessors, utils.DefaultSearchOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	report := &Consensus{}
+	if len(failed) > 0 {
+		report.Failed = make(map[string]string, len(failed))
+		for name, err := range failed {
+			report.Failed[name] = err.Error()
+			consensusStats.Add("failed_"+name, 1)
+		}
+	}
+	if len(found) == 0 {
+		return nil, report, fmt.Errorf("no decoder produced a payload")
+	}
+
+	byPayload := make(map[string]int)
+	for _, res := range found {
+		if i, ok := byPayload[string(res.Payload)]; ok {
+			report.Candidates[i].Decoders = append(report.Candidates[i].Decoders, res.Decoder)
+			continue
+		}
+		byPayload[string(res.Payload)] = len(report.Candidates)
+		sum := sha256.Sum256(res.Payload)
+		c := ConsensusCandidate{
+			Decoders: []string{res.Decoder},
+			Length:   len(res.Payload),
+			SHA256:   hex.EncodeToString(sum[:]),
+			result:   res,
+		}
+		if parsed, err := services.Parse(res.Payload, opts.PublicKey, services.ParseOptions{}); err == nil {
+			c.Type = parsed.Type
+			c.Signed, c.Verified = signatureStatus(parsed.Data)
+			switch {
+			case c.Signed && c.Verified:
+				c.rank = 3
+			case !c.Signed:
+				c.rank = 2
+			default:
+				c.rank = 1
+			}
+		}
+		report.Candidates = append(report.Candidates, c)
+	}
+
+	// Candidates are in decoder order, so a stable sort keeps it as the
+	// last tie-breaker.
+	sort.SliceStable(report.Candidates, func(i, j int) bool {
+		a, b := report.Candidates[i], report.Candidates[j]
+		if a.rank != b.rank {
+			return a.rank > b.rank
+		}
+		return len(a.Decoders) > len(b.Decoders)
+	})
+	chosen := &report.Candidates[0]
+	chosen.Chosen = true
+	for i := 1; i < len(report.Candidates); i++ {
+		c := &report.Candidates[i]
+		diff := firstDiff(c.result.Payload, chosen.result.Payload)
+		c.FirstDiff = &diff
+	}
+	report.Agreed = len(report.Candidates) == 1
+
+	consensusStats.Add("runs", 1)
+	switch {
+	case len(found) == 1:
+		consensusStats.Add("single", 1)
+	case report.Agreed:
+		consensusStats.Add("agreed", 1)
+	default:
+		consensusStats.Add("disagreed", 1)
+		for _, c := range report.Candidates[1:] {
+			log.Printf("[consensus] DISAGREEMENT: %v read %d bytes (sha256 %s, first diff at %d), chosen %v read %d bytes\n",
+				c.Decoders, c.Length, c.SHA256[:12], *c.FirstDiff, chosen.Decoders, chosen.Length)
+			for _, name := range c.Decoders {
+				consensusStats.Add("outvoted_"+name, 1)
+			}
+		}
+	}
+
+	res := chosen.result
+	res.Mode = string(ModeConsensus)
+	return res, report, nil
+}
+
+// firstDiff returns the first offset at which a and b differ, or the
+// shorter length if one is a prefix of the other.
+func firstDiff(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,84 @@
+package aadhaarqr
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/Aashish23092/aadhaar-qr-service/services"
+	"github.com/Aashish23092/aadhaar-qr-service/utils"
+)
+
+// Mode selects how the decoder chain is run.
+type Mode string
+
+const (
+	// ModeSequential tries decoders and image variants one at a time and
+	// takes the first payload. It is the default.
+	ModeSequential Mode = "sequential"
+	// ModeRace runs them concurrently and takes the first payload that
+	// parses and, for signed formats, passes signature verification.
+	// Without a PublicKey nothing can verify, so the first payload that
+	// parses wins.
+	ModeRace Mode = "race"
+	// ModeConsensus runs every decoder to completion, compares their
+	// payloads and reports disagreements; see Consensus.
+	ModeConsensus Mode = "consensus"
+)
+
+// ParseMode validates a mode name; "" is ModeSequential.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "", ModeSequential:
+		return ModeSequential, nil
+	case ModeRace, ModeConsensus:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown decode mode %q", s)
+	}
+}
+
+// search runs the decoder chain on img in the configured mode. The
+// Consensus report is only set in ModeConsensus.
+func search(ctx context.Context, img image.Image, opts Options) (*utils.DecodeResult, *Consensus, error) {
+	switch opts.Mode {
+	case ModeRace:
+		res, err := opts.Decoders.DecodeRace(ctx, img, utils.DefaultPreprocessors, utils.DefaultSearchOptions, utils.RaceOptions{
+			Workers: opts.Workers,
+			Accept:  func(res *utils.DecodeResult) bool { return verifiedPayload(res.Payload, opts) },
+		})
+		return res, nil, err
+	case ModeConsensus:
+		return consensus(ctx, img, opts)
+	}
+	res, err := opts.Decoders.DecodeSearchContext(ctx, img, utils.DefaultPreprocessors, utils.DefaultSearchOptions)
+	return res, nil, err
+}
+
+// verifiedPayload reports whether payload parses and, if its format is
+// signed and a key is configured, carries a valid signature. Requiring a
+// signature no key can check would reject every signed payload and leave
+// the race running every job.
+func verifiedPayload(payload []byte, opts Options) bool {
+	parsed, err := services.Parse(payload, opts.PublicKey, services.ParseOptions{})
+	if err != nil {
+		return false
+	}
+	if opts.PublicKey == nil {
+		return true
+	}
+	signed, valid := signatureStatus(parsed.Data)
+	return !signed || valid
+}
+
+// signatureStatus says whether parsed data comes from a signed format and
+// whether its signature verified.
+func signatureStatus(data interface{}) (signed, valid bool) {
+	switch d := data.(type) {
+	case *services.SecureQRV5:
+		return true, d.SignatureValid
+	case *services.AadhaarSecureQR:
+		return true, d.Valid
+	}
+	return false, false
+}
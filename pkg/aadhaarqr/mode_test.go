@@ -0,0 +1,45 @@
+package aadhaarqr
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestVerifiedPayload(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := `<OfflinePaperlessKyc referenceId="123420240101120000123"><UidData><Poi name="Test Resident"/></UidData></OfflinePaperlessKyc>`
+	unsigned := binarySecureQR(xml)
+	signed := append([]byte(nil), unsigned...)
+	hash := sha256.Sum256([]byte(xml))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(signed[len(signed)-256:], sig)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		pub     *rsa.PublicKey
+		want    bool
+	}{
+		{"valid signature", signed, &key.PublicKey, true},
+		{"bad signature", unsigned, &key.PublicKey, false},
+		{"signed payload without a key", unsigned, nil, true},
+		{"unsigned format", []byte(`<PrintLetterBarcodeData uid="234123412346" name="Test Resident"/>`), &key.PublicKey, true},
+		{"does not parse", []byte{0xff, 0x00, 0x13}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifiedPayload(tt.payload, Options{PublicKey: tt.pub}); got != tt.want {
+				t.Errorf("verifiedPayload = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
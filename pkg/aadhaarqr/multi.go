@@ -0,0 +1,80 @@
+package aadhaarqr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/Aashish23092/aadhaar-qr-service/utils"
+)
+
+// DecodeAll is Decode for inputs holding several QR codes, such as an
+// Aadhaar letter or a sheet of cards. Every code on every page is parsed
+// and returned in page and reading order; a code whose payload does not
+// parse comes back with Err set instead of failing the call.
+//
+// Only the registered decoders (zxing, and quirc and zbar when built in)
+// take part. The detector backends, OpenCV and WeChat included, locate a
+// single code and are not run, so an image only they can read yields
+// nothing here; Mode and Workers are ignored as well.
+func DecodeAll(ctx context.Context, r io.Reader, opts Options) ([]*Result, error) {
+	ctx, cancel := withBudget(ctx, StageOverall, opts.Timeouts.Overall)
+	defer cancel()
+
+	loaded, err := load(ctx, r, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// ========================================================
+	// STEP 4: Decode every QR code, page by page
+	// ========================================================
+	decodeCtx, cancelDecode := withBudget(ctx, StageDecode, opts.Timeouts.Decode)
+	defer cancelDecode()
+
+	var decoded []*utils.DecodeResult
+	var errs []string
+	for i, page := range loaded.Pages {
+		log.Printf("STEP 4: Decoding all QR codes on page %d of %d with %v\n", i+1, len(loaded.Pages), opts.Decoders.Names())
+		found, err := opts.Decoders.DecodeAll(decodeCtx, page, utils.DefaultPreprocessors, utils.DefaultSearchOptions)
+		if isContextError(err) {
+			log.Println("STEP 4 ERROR: Decoding stopped:", err)
+			return nil, err
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("page %d: %v", i+1, err))
+			continue
+		}
+		for _, res := range found {
+			if len(loaded.Pages) > 1 {
+				res.Page = i + 1
+			}
+		}
+		decoded = append(decoded, found...)
+	}
+	if len(decoded) == 0 {
+		log.Println("STEP 4B ERROR: All decoders failed:", strings.Join(errs, " || "))
+		return nil, fmt.Errorf("%w: %s", ErrNoQR, strings.Join(errs, " || "))
+	}
+	log.Printf("STEP 4: %d QR code(s) decoded\n", len(decoded))
+
+	return runStage(ctx, StageParse, opts.Timeouts.Parse, func(ctx context.Context) ([]*Result, error) {
+		results := make([]*Result, len(decoded))
+		for i, d := range decoded {
+			if ctx.Err() != nil {
+				return nil, context.Cause(ctx)
+			}
+			res, err := parse(d.Payload, opts)
+			if err != nil {
+				res = &Result{Payload: d.Payload, Err: err}
+			}
+			res.ImageFormat = loaded.Format
+			res.Decode = d
+			res.Exif = loaded.Exif
+			results[i] = res
+		}
+		return results, nil
+	})
+}
@@ -0,0 +1,125 @@
+package aadhaarqr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Pipeline stages, as reported in TimeoutError.
+const (
+	StageOverall = "overall"
+	StageLoad    = "load"
+	StageDetect  = "detect"
+	StageDecode  = "decode"
+	StageParse   = "parse"
+)
+
+// ErrTimeout matches every TimeoutError with errors.Is.
+var ErrTimeout = errors.New("decode timed out")
+
+// TimeoutError is returned when a stage, or the whole Decode, runs past
+// its budget in Timeouts. A caller's own deadline or cancellation is
+// returned as the plain context error instead.
+type TimeoutError struct {
+	Stage  string
+	Budget time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s stage exceeded its %v budget", e.Stage, e.Budget)
+}
+
+func (e *TimeoutError) Is(target error) bool { return target == ErrTimeout }
+
+// Timeouts are time budgets for Decode. Zero durations are unlimited. The
+// decode budget covers detection and the decoder chain over all pages;
+// detect bounds each detector run on its own.
+type Timeouts struct {
+	Overall time.Duration
+	Load    time.Duration
+	Detect  time.Duration
+	Decode  time.Duration
+	Parse   time.Duration
+}
+
+// ParseTimeouts reads a spec such as "overall=20s,decode=10s". A bare
+// duration ("15s") sets the overall budget.
+func ParseTimeouts(spec string) (Timeouts, error) {
+	var t Timeouts
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		stage, value, ok := strings.Cut(field, "=")
+		if !ok {
+			stage, value = StageOverall, field
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return Timeouts{}, fmt.Errorf("timeout %q: %v", field, err)
+		}
+		switch strings.TrimSpace(stage) {
+		case StageOverall:
+			t.Overall = d
+		case StageLoad:
+			t.Load = d
+		case StageDetect:
+			t.Detect = d
+		case StageDecode:
+			t.Decode = d
+		case StageParse:
+			t.Parse = d
+		default:
+			return Timeouts{}, fmt.Errorf("unknown stage %q", stage)
+		}
+	}
+	return t, nil
+}
+
+// withBudget derives a context that expires after budget with a
+// TimeoutError as its cause. A zero budget only adds cancellation.
+func withBudget(ctx context.Context, stage string, budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, budget, &TimeoutError{Stage: stage, Budget: budget})
+}
+
+// runStage runs fn under the stage budget. Stages that cannot observe ctx
+// themselves run in their own goroutine so the caller is freed as soon as
+// the budget runs out; the abandoned work finishes in the background, so
+// an fn that loops should check ctx between iterations to stop early.
+// fn is not started at all when ctx is already done.
+func runStage[T any](ctx context.Context, stage string, budget time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	ctx, cancel := withBudget(ctx, stage, budget)
+	defer cancel()
+	if ctx.Err() != nil {
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := fn(ctx)
+		done <- result{v, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil && ctx.Err() != nil {
+			return r.v, context.Cause(ctx)
+		}
+		return r.v, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+}
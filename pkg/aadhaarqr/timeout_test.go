@@ -0,0 +1,77 @@
+package aadhaarqr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTimeouts(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Timeouts
+		wantErr bool
+	}{
+		{spec: "", want: Timeouts{}},
+		{spec: "15s", want: Timeouts{Overall: 15 * time.Second}},
+		{spec: "overall=20s, decode=10s,parse=500ms", want: Timeouts{Overall: 20 * time.Second, Decode: 10 * time.Second, Parse: 500 * time.Millisecond}},
+		{spec: "load=1s,detect=2s", want: Timeouts{Load: time.Second, Detect: 2 * time.Second}},
+		{spec: "decode=soon", wantErr: true},
+		{spec: "render=1s", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimeouts(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimeouts(%q): err = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTimeouts(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestRunStage(t *testing.T) {
+	t.Run("budget exceeded", func(t *testing.T) {
+		stopped := make(chan error, 1)
+		_, err := runStage(context.Background(), StageParse, 10*time.Millisecond, func(ctx context.Context) (int, error) {
+			<-ctx.Done()
+			stopped <- ctx.Err()
+			return 0, nil
+		})
+		var timeout *TimeoutError
+		if !errors.As(err, &timeout) || timeout.Stage != StageParse || !errors.Is(err, ErrTimeout) {
+			t.Fatalf("err = %v, want parse TimeoutError", err)
+		}
+		// fn sees the cancellation and can stop its own loop.
+		if err := <-stopped; err == nil {
+			t.Error("fn's context not done")
+		}
+	})
+
+	t.Run("caller cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		started := false
+		_, err := runStage(ctx, StageLoad, time.Second, func(context.Context) (int, error) {
+			started = true
+			return 1, nil
+		})
+		if !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeout) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+		if started {
+			t.Error("fn started on a done context")
+		}
+	})
+
+	t.Run("within budget", func(t *testing.T) {
+		v, err := runStage(context.Background(), StageDetect, time.Second, func(context.Context) (int, error) {
+			return 42, nil
+		})
+		if err != nil || v != 42 {
+			t.Errorf("got %d, %v", v, err)
+		}
+	})
+}
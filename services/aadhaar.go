@@ -2,35 +2,51 @@ package services
 
 import (
 	"bytes"
-	"crypto"
 	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/binary"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"time"
 )
 
+// AadhaarOfflineKyc is the OfflinePaperlessKyc XML found in offline
+// e-KYC ZIPs and binary Secure QRs. See UnmarshalXML for the mapping.
 type AadhaarOfflineKyc struct {
-	XMLName     xml.Name `xml:"OfflinePaperlessKyc"`
-	ReferenceID string   `xml:"referenceId,attr"`
-	Name        string   `xml:"Poi name,attr"`
-	Gender      string   `xml:"Poi gender,attr"`
-	DOB         string   `xml:"Poi dob,attr"`
-	Phone       string   `xml:"Poi phone,attr"`
-	Email       string   `xml:"Poi email,attr"`
-
-	CO          string `xml:"Poa co,attr"`
-	House       string `xml:"Poa house,attr"`
-	Street      string `xml:"Poa street,attr"`
-	Landmark    string `xml:"Poa lm,attr"`
-	Locality    string `xml:"Poa loc,attr"`
-	VTC         string `xml:"Poa vtc,attr"`
-	SubDistrict string `xml:"Poa subdist,attr"`
-	District    string `xml:"Poa dist,attr"`
-	State       string `xml:"Poa state,attr"`
-	Pincode     string `xml:"Poa pc,attr"`
+	XMLName     xml.Name
+	ReferenceID string
+
+	// Decomposed referenceId: last 4 Aadhaar digits and the time UIDAI
+	// generated the document.
+	AadhaarLast4 string
+	GeneratedAt  time.Time `json:",omitzero"`
+
+	Name   string
+	Gender string
+	DOB    string
+	Phone  string
+	Email  string
+
+	// Poi m/e: hashed mobile and email (offline e-KYC hashes include the
+	// share code).
+	MobileHash string
+	EmailHash  string
+
+	CO          string
+	House       string
+	Street      string
+	Landmark    string
+	Locality    string
+	VTC         string
+	SubDistrict string
+	District    string
+	State       string
+	Pincode     string
+	PostOffice  string
+	Country     string
+
+	Photo []byte `json:"-"`
 }
 
 type AadhaarSecureQR struct {
@@ -39,11 +55,22 @@ type AadhaarSecureQR struct {
 	Valid     bool              `json:"signature_valid"`
 	RawXML    string            `json:"raw_xml"`
 	Reference string            `json:"reference"`
-	FullAddr  string            `json:"address"`
+	Address   Address           `json:"address"`
+	FullAddr  string            `json:"full_address"`
 	Name      string            `json:"name"`
 	Gender    string            `json:"gender"`
 	DOB       string            `json:"dob"`
 	Aadhaar   string            `json:"aadhaar_number,omitempty"`
+
+	AadhaarLast4 string    `json:"aadhaar_last4,omitempty"`
+	GeneratedAt  time.Time `json:"generated_at,omitzero"`
+
+	Demographics
+
+	// Set when the signature fails: the VerifyXMLDSig step, if any, and
+	// the error.
+	SignatureStep  string `json:"signature_failed_step,omitempty"`
+	SignatureError string `json:"signature_error,omitempty"`
 }
 
 func ParseSecureQR(data []byte, pub *rsa.PublicKey) (*AadhaarSecureQR, error) {
@@ -103,43 +130,50 @@ func ParseSecureQR(data []byte, pub *rsa.PublicKey) (*AadhaarSecureQR, error) {
 	}
 	signature := data[len(data)-256:]
 
-	// Validate signature (SHA-256 over XML only)
-	hash := sha256.Sum256(xmlBytes)
-	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature); err != nil {
-		return nil, fmt.Errorf("signature verification failed")
-	}
-
 	// Parse XML
 	var xmlKYC AadhaarOfflineKyc
 	if err := xml.Unmarshal(xmlBytes, &xmlKYC); err != nil {
 		return nil, fmt.Errorf("XML parse error: %v", err)
 	}
+	// Some payloads carry the photo only as Pht inside the XML.
+	if len(photoBytes) == 0 {
+		photoBytes = xmlKYC.Photo
+	}
+
+	addr := xmlKYC.Address()
+	q := &AadhaarSecureQR{
+		XML:          xmlKYC,
+		Photo:        photoBytes,
+		RawXML:       string(xmlBytes),
+		Reference:    xmlKYC.ReferenceID,
+		AadhaarLast4: xmlKYC.AadhaarLast4,
+		GeneratedAt:  xmlKYC.GeneratedAt,
+		Name:         xmlKYC.Name,
+		Gender:       xmlKYC.Gender,
+		DOB:          xmlKYC.DOB,
+		Address:      addr,
+		FullAddr:     addr.SingleLine(),
+		Demographics: NewDemographics(xmlKYC.DOB, xmlKYC.Gender),
+	}
 
-	// Build address
-	addr := fmt.Sprintf("%s %s %s %s %s %s %s %s %s %s",
-		xmlKYC.CO, xmlKYC.House, xmlKYC.Street, xmlKYC.Landmark,
-		xmlKYC.Locality, xmlKYC.SubDistrict, xmlKYC.District,
-		xmlKYC.State, xmlKYC.Pincode, xmlKYC.VTC,
-	)
-
-	return &AadhaarSecureQR{
-		XML:       xmlKYC,
-		Photo:     photoBytes,
-		Valid:     true,
-		RawXML:    string(xmlBytes),
-		Reference: xmlKYC.ReferenceID,
-		Name:      xmlKYC.Name,
-		Gender:    xmlKYC.Gender,
-		DOB:       xmlKYC.DOB,
-		FullAddr:  addr,
-	}, nil
+	// The XML is the signed Offline e-KYC document when it carries an
+	// enveloped XML signature; otherwise the trailing block is an RSA
+	// SHA-256 signature over the XML bytes. Either way a bad signature
+	// only marks the result unverified.
+	err := VerifyXMLDSig(xmlBytes, pub)
+	if errors.Is(err, ErrNoXMLSignature) {
+		err = verifySecureQRSignature(xmlBytes, signature, pub)
+	}
+	q.setSignature(err)
+	return q, nil
 }
 
+// ParseAadhaarQR parses any supported QR payload and returns the parsed
+// data together with its response type, e.g. "secure_qr_v4".
 func ParseAadhaarQR(data []byte, pub *rsa.PublicKey) (interface{}, string, error) {
-	// Try secure QR
-	if sec, err := ParseSecureQR(data, pub); err == nil {
-		return sec, "secure", nil
+	res, err := Parse(data, pub, ParseOptions{})
+	if err != nil {
+		return nil, "", err
 	}
-
-	return nil, "", errors.New("unrecognized Aadhaar QR format")
+	return res.Data, res.Type, nil
 }
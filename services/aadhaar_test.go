@@ -0,0 +1,73 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+// binarySecureQR lays out a version 2 binary Secure QR payload.
+func binarySecureQR(xml, signature []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(2))
+	binary.Write(&b, binary.LittleEndian, uint16(0))
+	binary.Write(&b, binary.LittleEndian, uint32(len(xml)))
+	b.Write(xml)
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	b.Write(signature)
+	return b.Bytes()
+}
+
+func TestParseSecureQRSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte(`<OfflinePaperlessKyc referenceId="123420240101120000123"><UidData><Poi name="Ravi Kumar" dob="01-01-1990" gender="M"/></UidData></OfflinePaperlessKyc>`)
+	hash := sha256.Sum256(plain)
+	pkcs1, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := signedKYC(t, "kyc_inc_ds.xml")
+	zeros := make([]byte, 256)
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		pub       *rsa.PublicKey
+		wantValid bool
+		wantStep  string
+	}{
+		{"trailing signature", binarySecureQR(plain, pkcs1), &key.PublicKey, true, ""},
+		{"bad trailing signature", binarySecureQR(plain, zeros), &key.PublicKey, false, ""},
+		{"trailing signature, no key", binarySecureQR(plain, pkcs1), nil, false, ""},
+		{"XML signature", binarySecureQR(signed, zeros), testKey(t), true, ""},
+		{"XML signature, wrong key", binarySecureQR(signed, zeros), &key.PublicKey, false, XMLDSigStepSignatureValue},
+		{"tampered XML signature", binarySecureQR(bytes.Replace(signed, []byte("Mohan"), []byte("Mohit"), 1), zeros), testKey(t), false, XMLDSigStepDigest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseSecureQR(tt.payload, tt.pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Name != "Ravi Kumar" {
+				t.Errorf("Name = %q", q.Name)
+			}
+			if q.Valid != tt.wantValid {
+				t.Errorf("Valid = %v (%s), want %v", q.Valid, q.SignatureError, tt.wantValid)
+			}
+			if q.SignatureStep != tt.wantStep {
+				t.Errorf("SignatureStep = %q, want %q", q.SignatureStep, tt.wantStep)
+			}
+			if !q.Valid && q.SignatureError == "" {
+				t.Error("invalid signature without SignatureError")
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Address is the resident address as carried by every Aadhaar format.
+// Parsers fill the components and call normalize, which tidies them and
+// derives StateCode and PincodeValid.
+type Address struct {
+	CareOf      string `json:"care_of,omitempty"`
+	House       string `json:"house,omitempty"`
+	Street      string `json:"street,omitempty"`
+	Landmark    string `json:"landmark,omitempty"`
+	Locality    string `json:"locality,omitempty"`
+	VTC         string `json:"vtc,omitempty"`
+	PostOffice  string `json:"post_office,omitempty"`
+	SubDistrict string `json:"sub_district,omitempty"`
+	District    string `json:"district,omitempty"`
+	State       string `json:"state,omitempty"`
+	Pincode     string `json:"pincode,omitempty"`
+	Country     string `json:"country,omitempty"`
+
+	// ISO 3166-2:IN subdivision code, e.g. "IN-MH"; empty when the state
+	// name is not recognised.
+	StateCode    string `json:"state_code,omitempty"`
+	PincodeValid bool   `json:"pincode_valid"`
+}
+
+// normalize collapses whitespace in every component and fills the
+// derived fields.
+func (a Address) normalize() Address {
+	for _, p := range []*string{
+		&a.CareOf, &a.House, &a.Street, &a.Landmark, &a.Locality, &a.VTC,
+		&a.PostOffice, &a.SubDistrict, &a.District, &a.State, &a.Country,
+	} {
+		*p = strings.Join(strings.Fields(*p), " ")
+	}
+	a.Pincode = strings.Join(strings.Fields(a.Pincode), "")
+	a.PincodeValid = ValidPincode(a.Pincode)
+	a.StateCode = StateCode(a.State)
+	return a
+}
+
+// Lines renders the address the way it is printed on an Aadhaar letter:
+// care of; house, street and landmark; locality, VTC and post office;
+// sub-district and district; state and pincode; country. Empty parts are
+// skipped, as are parts repeating an earlier one (UIDAI often sets VTC,
+// post office and district to the same town).
+func (a Address) Lines() []string {
+	seen := make(map[string]bool)
+	join := func(sep string, parts ...string) string {
+		var kept []string
+		for _, p := range parts {
+			key := strings.ToLower(p)
+			if p == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			kept = append(kept, p)
+		}
+		return strings.Join(kept, sep)
+	}
+
+	var lines []string
+	for _, l := range []string{
+		a.CareOf,
+		join(", ", a.House, a.Street, a.Landmark),
+		join(", ", a.Locality, a.VTC, a.PostOffice),
+		join(", ", a.SubDistrict, a.District),
+		join(" - ", a.State, a.Pincode),
+		join("", a.Country),
+	} {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// SingleLine joins Lines with commas.
+func (a Address) SingleLine() string {
+	return strings.Join(a.Lines(), ", ")
+}
+
+// MarshalJSON adds the rendered "single_line" and "lines" to the
+// components.
+func (a Address) MarshalJSON() ([]byte, error) {
+	type address Address
+	return json.Marshal(struct {
+		address
+		SingleLine string   `json:"single_line"`
+		Lines      []string `json:"lines"`
+	}{address(a), a.SingleLine(), a.Lines()})
+}
+
+// ValidPincode reports whether pc is a 6-digit Indian postal index
+// number. PINs never start with 0.
+func ValidPincode(pc string) bool {
+	return len(pc) == 6 && isDecimal([]byte(pc)) && pc[0] != '0'
+}
+
+// StateCode returns the ISO 3166-2:IN code for a state or union territory
+// name, accepting former names, "&" for "and" and bare codes ("MH").
+func StateCode(name string) string {
+	key := stateKey(name)
+	if key == "" {
+		return ""
+	}
+	if code, ok := stateCodes[key]; ok {
+		return code
+	}
+	key = strings.TrimPrefix(key, "in")
+	for _, code := range stateCodes {
+		if strings.EqualFold(code[len("IN-"):], key) {
+			return code
+		}
+	}
+	return ""
+}
+
+// stateKey lowercases name and keeps only letters, with "&" read as
+// "and", so "Jammu & Kashmir" and "JAMMU AND KASHMIR" share a key.
+func stateKey(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "&", "and")
+	var b strings.Builder
+	for _, ch := range name {
+		if ch >= 'a' && ch <= 'z' {
+			b.WriteRune(ch)
+		}
+	}
+	return b.String()
+}
+
+// stateCodes maps stateKey of current and former state and union
+// territory names to their ISO 3166-2:IN code.
+var stateCodes = map[string]string{
+	"andamanandnicobarislands":             "IN-AN",
+	"andamanandnicobar":                    "IN-AN",
+	"andhrapradesh":                        "IN-AP",
+	"arunachalpradesh":                     "IN-AR",
+	"assam":                                "IN-AS",
+	"bihar":                                "IN-BR",
+	"chandigarh":                           "IN-CH",
+	"chhattisgarh":                         "IN-CG",
+	"chattisgarh":                          "IN-CG",
+	"dadraandnagarhavelianddamananddiu":    "IN-DH",
+	"thedadraandnagarhavelianddamananddiu": "IN-DH",
+	"dadraandnagarhaveli":                  "IN-DH",
+	"damananddiu":                          "IN-DH",
+	"delhi":                                "IN-DL",
+	"nctofdelhi":                           "IN-DL",
+	"newdelhi":                             "IN-DL",
+	"goa":                                  "IN-GA",
+	"gujarat":                              "IN-GJ",
+	"haryana":                              "IN-HR",
+	"himachalpradesh":                      "IN-HP",
+	"jammuandkashmir":                      "IN-JK",
+	"jharkhand":                            "IN-JH",
+	"karnataka":                            "IN-KA",
+	"kerala":                               "IN-KL",
+	"ladakh":                               "IN-LA",
+	"lakshadweep":                          "IN-LD",
+	"madhyapradesh":                        "IN-MP",
+	"maharashtra":                          "IN-MH",
+	"manipur":                              "IN-MN",
+	"meghalaya":                            "IN-ML",
+	"mizoram":                              "IN-MZ",
+	"nagaland":                             "IN-NL",
+	"odisha":                               "IN-OD",
+	"orissa":                               "IN-OD",
+	"puducherry":                           "IN-PY",
+	"pondicherry":                          "IN-PY",
+	"punjab":                               "IN-PB",
+	"rajasthan":                            "IN-RJ",
+	"sikkim":                               "IN-SK",
+	"tamilnadu":                            "IN-TN",
+	"telangana":                            "IN-TG",
+	"tripura":                              "IN-TR",
+	"uttarpradesh":                         "IN-UP",
+	"uttarakhand":                          "IN-UK",
+	"uttaranchal":                          "IN-UK",
+	"westbengal":                           "IN-WB",
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ContactHashes are the hashed mobile/email carried in a Secure QR along
+// with the Aadhaar digits that decide how often they were hashed.
+// SignatureValid says whether they come from a QR whose UIDAI signature
+// verified; anyone can make a QR carrying the hashes of their choice.
+type ContactHashes struct {
+	MobileHash     string `json:"mobile_hash,omitempty"`
+	EmailHash      string `json:"email_hash,omitempty"`
+	AadhaarLast4   string `json:"aadhaar_last4,omitempty"`
+	SignatureValid bool   `json:"signature_valid"`
+}
+
+// ContactVerification reports which candidates were checked and whether
+// they matched the hashes in the QR. A match is only reported when the
+// QR's signature verified.
+type ContactVerification struct {
+	SignatureValid bool `json:"signature_valid"`
+	MobileChecked  bool `json:"mobile_checked"`
+	MobileMatch    bool `json:"mobile_match"`
+	EmailChecked   bool `json:"email_checked"`
+	EmailMatch     bool `json:"email_match"`
+}
+
+func (q *SecureQRV5) ContactHashes() ContactHashes {
+	return ContactHashes{MobileHash: q.MobileHash, EmailHash: q.EmailHash, AadhaarLast4: q.AadhaarLast4, SignatureValid: q.SignatureValid}
+}
+
+// ContactHashes of a V1 QR are never signature verified: V1 carries no
+// signature.
+func (q *SecureQRV1) ContactHashes() ContactHashes {
+	h := ContactHashes{MobileHash: q.MobileHash, EmailHash: q.EmailHash}
+	if len(q.ReferenceID) >= 4 {
+		h.AadhaarLast4 = q.ReferenceID[:4]
+	}
+	return h
+}
+
+// ContactHashesFromQR parses a numeric Secure QR payload and returns the
+// contact hashes it carries.
+func ContactHashesFromQR(raw []byte, pub *rsa.PublicKey) (ContactHashes, error) {
+	if q, err := ParseSecureQRV5(raw, pub); err == nil {
+		return q.ContactHashes(), nil
+	}
+	if q, err := ParseSecureQRV1(raw, nil); err == nil {
+		return q.ContactHashes(), nil
+	}
+	return ContactHashes{}, errors.New("payload is not a Secure QR")
+}
+
+// HashContact applies the UIDAI contact hashing scheme: SHA-256 of the
+// value, re-hashed as a hex string once per the last Aadhaar digit (a
+// last digit of 0 or 1 means a single round).
+func HashContact(value, aadhaarLast4 string) (string, error) {
+	if len(aadhaarLast4) == 0 {
+		return "", errors.New("aadhaar digits required")
+	}
+	last := aadhaarLast4[len(aadhaarLast4)-1]
+	if last < '0' || last > '9' {
+		return "", fmt.Errorf("invalid aadhaar digits %q", aadhaarLast4)
+	}
+
+	rounds := int(last - '0')
+	if rounds < 1 {
+		rounds = 1
+	}
+
+	h := value
+	for i := 0; i < rounds; i++ {
+		sum := sha256.Sum256([]byte(h))
+		h = hex.EncodeToString(sum[:])
+	}
+	return h, nil
+}
+
+// VerifyContact checks the candidate mobile and/or email against the
+// hashes. Empty candidates are skipped; a candidate without a matching
+// hash in the QR is an error. Hashes whose signature did not verify never
+// match.
+func VerifyContact(hashes ContactHashes, mobile, email string) (*ContactVerification, error) {
+	mobile = NormalizeMobile(mobile)
+	email = strings.TrimSpace(email)
+	if mobile == "" && email == "" {
+		return nil, errors.New("mobile or email required")
+	}
+
+	res := &ContactVerification{SignatureValid: hashes.SignatureValid}
+	if mobile != "" {
+		if hashes.MobileHash == "" {
+			return nil, errors.New("QR carries no mobile hash")
+		}
+		h, err := HashContact(mobile, hashes.AadhaarLast4)
+		if err != nil {
+			return nil, err
+		}
+		res.MobileChecked = true
+		res.MobileMatch = hashes.SignatureValid && hashEqual(h, hashes.MobileHash)
+	}
+	if email != "" {
+		if hashes.EmailHash == "" {
+			return nil, errors.New("QR carries no email hash")
+		}
+		h, err := HashContact(email, hashes.AadhaarLast4)
+		if err != nil {
+			return nil, err
+		}
+		res.EmailChecked = true
+		res.EmailMatch = hashes.SignatureValid && hashEqual(h, hashes.EmailHash)
+	}
+	return res, nil
+}
+
+// NormalizeMobile reduces a phone number to its 10 national digits,
+// dropping spaces, dashes and a +91/0 prefix.
+func NormalizeMobile(s string) string {
+	var b strings.Builder
+	for _, ch := range s {
+		if ch >= '0' && ch <= '9' {
+			b.WriteRune(ch)
+		}
+	}
+	digits := b.String()
+	switch {
+	case len(digits) == 12 && strings.HasPrefix(digits, "91"):
+		digits = digits[2:]
+	case len(digits) == 11 && strings.HasPrefix(digits, "0"):
+		digits = digits[1:]
+	}
+	return digits
+}
+
+func hashEqual(a, b string) bool {
+	a = strings.ToLower(strings.TrimSpace(a))
+	b = strings.ToLower(strings.TrimSpace(b))
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
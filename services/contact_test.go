@@ -0,0 +1,63 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVerifyContactSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reference ID 1234...: the last Aadhaar digit 4 means four rounds.
+	mobileHash, err := HashContact("9876543210", "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	emailHash, err := HashContact("ravi@example.com", "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mobile, _ := hex.DecodeString(mobileHash)
+	email, _ := hex.DecodeString(emailHash)
+	signed := decimalQR(secureQRData(t, "V2", '3', []byte("photo"), email, mobile, key))
+	unsigned := decimalQR(secureQRData(t, "V2", '3', []byte("photo"), email, mobile, nil))
+
+	tests := []struct {
+		name          string
+		qr            []byte
+		mobile, email string
+		want          ContactVerification
+	}{
+		{"signed, both match", signed, "+91 98765 43210", "ravi@example.com",
+			ContactVerification{SignatureValid: true, MobileChecked: true, MobileMatch: true, EmailChecked: true, EmailMatch: true}},
+		{"signed, wrong mobile", signed, "9876543211", "",
+			ContactVerification{SignatureValid: true, MobileChecked: true}},
+		{"unsigned never matches", unsigned, "9876543210", "ravi@example.com",
+			ContactVerification{MobileChecked: true, EmailChecked: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashes, err := ContactHashesFromQR(tt.qr, &key.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := VerifyContact(hashes, tt.mobile, tt.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	// Bare hashes are not signature verified either.
+	got, err := VerifyContact(ContactHashes{MobileHash: mobileHash, AadhaarLast4: "1234"}, "9876543210", "")
+	if err != nil || got.MobileMatch || got.SignatureValid {
+		t.Errorf("bare hashes: got %+v, %v", got, err)
+	}
+}
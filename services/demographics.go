@@ -0,0 +1,144 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DatePrecision says how much of a BirthDate the payload carried.
+type DatePrecision string
+
+const (
+	DatePrecisionDay  DatePrecision = "day"
+	DatePrecisionYear DatePrecision = "year"
+)
+
+// BirthDate is a parsed date of birth. For year-only precision Date is
+// January 1st of that year.
+type BirthDate struct {
+	Date      time.Time
+	Precision DatePrecision
+}
+
+// birthDateLayouts are the DOB spellings seen across UIDAI formats.
+var birthDateLayouts = []string{
+	"02-01-2006", // Secure QR, offline e-KYC
+	"02/01/2006", // older letters
+	"02.01.2006",
+	"2006-01-02",
+	"2006/01/02",
+}
+
+// ParseBirthDate parses a DOB in any of the UIDAI layouts, or a bare
+// 4-digit year of birth.
+func ParseBirthDate(s string) (BirthDate, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 4 && isDecimal([]byte(s)) {
+		t, err := time.Parse("2006", s)
+		if err != nil {
+			return BirthDate{}, fmt.Errorf("invalid year of birth %q", s)
+		}
+		return BirthDate{Date: t, Precision: DatePrecisionYear}, nil
+	}
+	for _, layout := range birthDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return BirthDate{Date: t, Precision: DatePrecisionDay}, nil
+		}
+	}
+	return BirthDate{}, fmt.Errorf("unrecognised date of birth %q", s)
+}
+
+// Age returns the completed years at asOf. A year-only date is taken as
+// December 31st, so the result never overstates the age.
+func (b BirthDate) Age(asOf time.Time) int {
+	birth := b.Date
+	if b.Precision == DatePrecisionYear {
+		birth = time.Date(birth.Year(), time.December, 31, 0, 0, 0, 0, time.UTC)
+	}
+	age := asOf.Year() - birth.Year()
+	if asOf.Month() < birth.Month() || asOf.Month() == birth.Month() && asOf.Day() < birth.Day() {
+		age--
+	}
+	return age
+}
+
+// String renders the date as YYYY-MM-DD, or YYYY for year precision.
+func (b BirthDate) String() string {
+	if b.Precision == DatePrecisionYear {
+		return b.Date.Format("2006")
+	}
+	return b.Date.Format("2006-01-02")
+}
+
+func (b BirthDate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Date      string        `json:"date"`
+		Precision DatePrecision `json:"precision"`
+	}{b.String(), b.Precision})
+}
+
+// Gender is the normalized gender of the resident.
+type Gender string
+
+const (
+	GenderMale        Gender = "male"
+	GenderFemale      Gender = "female"
+	GenderTransgender Gender = "transgender"
+	GenderUnknown     Gender = "unknown"
+)
+
+// ParseGender maps the codes and words used by UIDAI formats (M/F/T,
+// MALE, Female, ...) to a Gender.
+func ParseGender(s string) Gender {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "M", "MALE":
+		return GenderMale
+	case "F", "FEMALE":
+		return GenderFemale
+	case "T", "TG", "TRANSGENDER", "O", "OTHER", "OTHERS":
+		return GenderTransgender
+	default:
+		return GenderUnknown
+	}
+}
+
+// Demographics are the normalized DOB, age and gender, embedded in every
+// parsed QR type so they appear uniformly in responses.
+type Demographics struct {
+	BirthDate *BirthDate `json:"birth_date,omitempty"`
+	Age       *int       `json:"age,omitempty"`
+	Sex       Gender     `json:"sex"`
+}
+
+// NewDemographics normalizes a raw DOB (or year of birth) and gender,
+// with the age as of now. An unparseable DOB leaves BirthDate and Age
+// unset; the raw value stays in the parser's own field.
+func NewDemographics(dob, gender string) Demographics {
+	d := Demographics{Sex: ParseGender(gender)}
+	if bd, err := ParseBirthDate(dob); err == nil {
+		d.BirthDate = &bd
+		d.SetAge(time.Now())
+	}
+	return d
+}
+
+// SetAge recomputes Age as of asOf. Dates after asOf leave Age unset.
+func (d *Demographics) SetAge(asOf time.Time) {
+	d.Age = nil
+	if d.BirthDate == nil {
+		return
+	}
+	if age := d.BirthDate.Age(asOf); age >= 0 {
+		d.Age = &age
+	}
+}
+
+func (d *Demographics) demographics() *Demographics { return d }
+
+// demographic is implemented by every parsed type through the embedded
+// Demographics.
+type demographic interface {
+	demographics() *Demographics
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type Format string
+
+const (
+	FormatUnknown        Format = "unknown"
+	FormatSecureQR       Format = "secure_qr"
+	FormatSecureQRV1     Format = "secure_qr_v1"
+	FormatSecureQRBinary Format = "secure_qr_binary"
+	FormatLegacyXML      Format = "legacy_qr"
+	FormatOfflineKYC     Format = "offline_kyc"
+	FormatPlainText      Format = "old_qr"
+)
+
+// FormatInfo is the result of sniffing a QR payload before parsing it.
+type FormatInfo struct {
+	Format     Format  `json:"format"`
+	Version    string  `json:"version,omitempty"`
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason"`
+}
+
+// ErrUnknownFormat is returned by Detect when nothing about the payload
+// matches a known Aadhaar QR layout.
+var ErrUnknownFormat = errors.New("unrecognized Aadhaar QR format")
+
+// Detect classifies a decoded QR payload by its structure: decimal-wrapped
+// gzip (Secure QR), little-endian binary header, XML root element or plain
+// text. It does not verify signatures.
+func Detect(payload []byte) (FormatInfo, error) {
+	info, _, err := detect(payload)
+	return info, err
+}
+
+// detect is Detect that also returns what the format's parser reads: the
+// inflated data of decimal payloads, so they are only inflated once, and
+// the XML without any leading bytes.
+func detect(payload []byte) (FormatInfo, []byte, error) {
+	if len(payload) == 0 {
+		return FormatInfo{Format: FormatUnknown, Reason: "empty payload"}, nil, ErrUnknownFormat
+	}
+
+	if isDecimal(payload) {
+		return detectNumeric(payload)
+	}
+
+	// Binary Secure QRs embed XML too, so their header is checked first.
+	if info, ok := detectBinary(payload); ok {
+		return info, payload, nil
+	}
+
+	// Scanners sometimes prepend a BOM or stray bytes before the XML;
+	// the XML parsers skip them the same way.
+	if start := xmlStart(payload); start >= 0 {
+		doc := payload[start:]
+		reason := ""
+		if start > 0 {
+			reason = fmt.Sprintf(" after %d leading bytes", start)
+		}
+		if bytes.Contains(doc, []byte("<PrintLetterBarcodeData")) {
+			return FormatInfo{Format: FormatLegacyXML, Confidence: 0.95,
+				Reason: "XML with PrintLetterBarcodeData root" + reason}, doc, nil
+		}
+		if bytes.Contains(doc, []byte("<OfflinePaperlessKyc")) {
+			return FormatInfo{Format: FormatOfflineKYC, Confidence: 0.95,
+				Reason: "XML with OfflinePaperlessKyc root" + reason}, doc, nil
+		}
+	}
+
+	if utf8.Valid(payload) {
+		return FormatInfo{Format: FormatPlainText, Confidence: 0.3,
+			Reason: "printable text with no known Aadhaar structure"}, payload, nil
+	}
+
+	return FormatInfo{Format: FormatUnknown, Reason: "binary payload with no known header"}, nil, ErrUnknownFormat
+}
+
+// xmlStart returns the offset of the first '<' in payload, or -1.
+func xmlStart(payload []byte) int {
+	return bytes.IndexByte(payload, '<')
+}
+
+func detectNumeric(payload []byte) (FormatInfo, []byte, error) {
+	data, err := inflateDecimal(payload)
+	if err != nil {
+		return FormatInfo{Format: FormatUnknown,
+			Reason: fmt.Sprintf("numeric payload but %v", err)}, nil, ErrUnknownFormat
+	}
+
+	if len(data) > 1 && data[0] == 'V' && data[1] >= '0' && data[1] <= '9' {
+		end := bytes.IndexByte(data, secureQRDelimiter)
+		if end > 0 && end <= 4 {
+			return FormatInfo{Format: FormatSecureQR, Version: string(data[:end]), Confidence: 0.99,
+				Reason: "decimal gzip payload with version field and 0xFF delimiters"}, data, nil
+		}
+	}
+
+	if len(data) > 1 && data[0] >= '0' && data[0] <= '3' && data[1] == secureQRDelimiter {
+		return FormatInfo{Format: FormatSecureQR, Confidence: 0.95,
+			Reason: "decimal gzip payload starting with email/mobile indicator and 0xFF delimiters"}, data, nil
+	}
+
+	if bytes.Count(data, []byte("\n")) >= 5 && utf8.Valid(data) {
+		return FormatInfo{Format: FormatSecureQRV1, Version: "V1", Confidence: 0.7,
+			Reason: "decimal gzip payload with newline separated text fields"}, data, nil
+	}
+
+	return FormatInfo{Format: FormatUnknown,
+		Reason: "decimal gzip payload with unrecognized field layout"}, nil, ErrUnknownFormat
+}
+
+// detectBinary recognises the little-endian length-prefixed layout read by
+// ParseSecureQR: version(2) format(2) xmlLen(4) xml photoLen(4) photo sig.
+func detectBinary(payload []byte) (FormatInfo, bool) {
+	if len(payload) < 2+2+4+4+secureQRSignatureLen {
+		return FormatInfo{}, false
+	}
+	version := binary.LittleEndian.Uint16(payload)
+	if version != 1 && version != 2 {
+		return FormatInfo{}, false
+	}
+	xmlLen := binary.LittleEndian.Uint32(payload[4:])
+	if xmlLen == 0 || uint64(xmlLen)+8 > uint64(len(payload)) || payload[8] != '<' {
+		return FormatInfo{}, false
+	}
+	return FormatInfo{Format: FormatSecureQRBinary, Version: fmt.Sprintf("%d", version), Confidence: 0.8,
+		Reason: "binary header with known version and in-bounds XML length"}, true
+}
+
+func inflateDecimal(payload []byte) ([]byte, error) {
+	bi := new(big.Int)
+	if _, ok := bi.SetString(string(payload), 10); !ok {
+		return nil, errors.New("not a decimal number")
+	}
+	zipped := bi.Bytes()
+	if len(zipped) < 2 || zipped[0] != 0x1f || zipped[1] != 0x8b {
+		return nil, errors.New("not gzip data")
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(zipped))
+	if err != nil {
+		return nil, fmt.Errorf("gunzip error: %v", err)
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
+
+func isDecimal(b []byte) bool {
+	for _, ch := range b {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return len(b) > 0
+}
+
+// ParseOptions tweak how Parse presents the parsed data.
+type ParseOptions struct {
+	// RevealUID returns full Aadhaar numbers instead of masking them.
+	RevealUID bool
+	// AgeAsOf is the reference date for Age; zero means now.
+	AgeAsOf time.Time
+}
+
+// ParseResult is a parsed QR payload together with how it was detected.
+type ParseResult struct {
+	Info  FormatInfo  `json:"format"`
+	Type  string      `json:"type"`
+	Data  interface{} `json:"data"`
+	Photo []byte      `json:"-"`
+}
+
+// Parse detects the payload format and hands it to the matching parser.
+// The result carries the detected format even when parsing fails.
+func Parse(payload []byte, pub *rsa.PublicKey, opts ParseOptions) (*ParseResult, error) {
+	info, data, err := detect(payload)
+	if err != nil {
+		return &ParseResult{Info: info}, fmt.Errorf("%w: %s", err, info.Reason)
+	}
+
+	res := &ParseResult{Info: info, Type: string(info.Format)}
+	switch info.Format {
+	case FormatSecureQR:
+		q, err := parseSecureQRData(data, pub)
+		if err != nil {
+			return res, err
+		}
+		res.Data, res.Photo = q, q.Photo
+		if q.Version != "" {
+			res.Type = string(FormatSecureQR) + "_" + strings.ToLower(q.Version)
+		}
+	case FormatSecureQRV1:
+		q, err := parseSecureQRV1Data(data)
+		if err != nil {
+			return res, err
+		}
+		res.Data = q
+	case FormatSecureQRBinary:
+		q, err := ParseSecureQR(payload, pub)
+		if err != nil {
+			return res, err
+		}
+		res.Data, res.Photo = q, q.Photo
+		res.Type = "secure_qr_v2"
+	case FormatLegacyXML:
+		q, err := ParseLegacyQR(data, opts.RevealUID)
+		if err != nil {
+			return res, err
+		}
+		res.Data = q
+	case FormatOfflineKYC:
+		q, err := ParseOfflineKYCXML(data, pub)
+		if err != nil {
+			return res, err
+		}
+		res.Data, res.Photo = q, q.Photo
+	case FormatPlainText:
+		res.Data = map[string]string{"raw_text": string(payload)}
+	default:
+		return res, ErrUnknownFormat
+	}
+	if d, ok := res.Data.(demographic); ok && !opts.AgeAsOf.IsZero() {
+		d.demographics().SetAge(opts.AgeAsOf)
+	}
+	return res, nil
+}
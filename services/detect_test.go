@@ -0,0 +1,90 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// decimalQR wraps data the way Secure QRs do: gzip, read as a big-endian
+// integer, written in decimal.
+func decimalQR(data []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return []byte(new(big.Int).SetBytes(b.Bytes()).String())
+}
+
+const legacyXML = `<?xml version="1.0" encoding="UTF-8"?><PrintLetterBarcodeData uid="234123412346" name="Ravi Kumar" gender="M" yob="1990" co="S/O: Mohan" house="12" street="MG Road" vtc="Pune" dist="Pune" state="Maharashtra" pc="411038"/>`
+
+func TestDetect(t *testing.T) {
+	fields := []byte("V2\xff3\xff123420240101120000123\xffRavi Kumar\xff01-01-1990\xffM")
+	tests := []struct {
+		name        string
+		payload     []byte
+		wantFormat  Format
+		wantVersion string
+		wantErr     bool
+	}{
+		{name: "Secure QR V2", payload: decimalQR(fields), wantFormat: FormatSecureQR, wantVersion: "V2"},
+		{name: "Secure QR unversioned", payload: decimalQR(fields[3:]), wantFormat: FormatSecureQR},
+		{name: "Secure QR V1", payload: decimalQR([]byte("Ravi Kumar\n01-01-1990\nM\n1234\nmh\neh\n")), wantFormat: FormatSecureQRV1, wantVersion: "V1"},
+		{name: "decimal but not gzip", payload: []byte("123456789"), wantFormat: FormatUnknown, wantErr: true},
+		{name: "gzip of unknown layout", payload: decimalQR([]byte("hello")), wantFormat: FormatUnknown, wantErr: true},
+		{name: "binary Secure QR", payload: binarySecureQR([]byte(`<OfflinePaperlessKyc referenceId="1"/>`), make([]byte, 256)), wantFormat: FormatSecureQRBinary, wantVersion: "2"},
+		{name: "legacy XML", payload: []byte(legacyXML), wantFormat: FormatLegacyXML},
+		{name: "legacy XML after BOM", payload: []byte("\xef\xbb\xbf" + legacyXML), wantFormat: FormatLegacyXML},
+		{name: "legacy XML after stray bytes", payload: []byte("]Q1" + legacyXML), wantFormat: FormatLegacyXML},
+		{name: "offline e-KYC XML", payload: []byte(` <OfflinePaperlessKyc referenceId="1"/>`), wantFormat: FormatOfflineKYC},
+		{name: "plain text", payload: []byte("Name: Ravi Kumar"), wantFormat: FormatPlainText},
+		{name: "binary junk", payload: []byte{0xff, 0xfe, 0x00, 0x80}, wantFormat: FormatUnknown, wantErr: true},
+		{name: "empty", payload: nil, wantFormat: FormatUnknown, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Detect(tt.payload)
+			if tt.wantErr != errors.Is(err, ErrUnknownFormat) {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if info.Format != tt.wantFormat || info.Version != tt.wantVersion {
+				t.Errorf("got %s %q (%s), want %s %q", info.Format, info.Version, info.Reason, tt.wantFormat, tt.wantVersion)
+			}
+		})
+	}
+}
+
+// TestParseLeadingBytes checks Parse accepts whatever Detect accepts.
+func TestParseLeadingBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    Format
+	}{
+		{"legacy XML", "]Q1" + legacyXML, FormatLegacyXML},
+		{"offline e-KYC XML", "\xef\xbb\xbf\n" + `<OfflinePaperlessKyc referenceId="123420240101120000123"><UidData><Poi name="Ravi Kumar"/></UidData></OfflinePaperlessKyc>`, FormatOfflineKYC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Parse([]byte(tt.payload), nil, ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Info.Format != tt.want {
+				t.Errorf("format = %s, want %s", res.Info.Format, tt.want)
+			}
+			switch q := res.Data.(type) {
+			case *LegacyQR:
+				if q.Name != "Ravi Kumar" || !q.UIDValid {
+					t.Errorf("got %+v", q)
+				}
+			case *AadhaarSecureQR:
+				if q.Name != "Ravi Kumar" {
+					t.Errorf("got %+v", q)
+				}
+			}
+		})
+	}
+}
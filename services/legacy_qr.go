@@ -0,0 +1,76 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// LegacyQR is the unsigned QR printed on older Aadhaar letters:
+// <PrintLetterBarcodeData uid=".." name=".." gender=".." yob=".." .../>
+type LegacyQR struct {
+	XMLName  xml.Name `xml:"PrintLetterBarcodeData" json:"-"`
+	UID      string   `xml:"uid,attr" json:"uid"`
+	UIDValid bool     `xml:"-" json:"uid_valid"`
+	Name     string   `xml:"name,attr" json:"name"`
+	Gender   string   `xml:"gender,attr" json:"gender"`
+	YOB      string   `xml:"yob,attr" json:"yob,omitempty"`
+	DOB      string   `xml:"dob,attr" json:"dob,omitempty"`
+	CareOf   string   `xml:"co,attr" json:"care_of,omitempty"`
+	House    string   `xml:"house,attr" json:"house,omitempty"`
+	Street   string   `xml:"street,attr" json:"street,omitempty"`
+	Landmark string   `xml:"lm,attr" json:"landmark,omitempty"`
+	Locality string   `xml:"loc,attr" json:"locality,omitempty"`
+	VTC      string   `xml:"vtc,attr" json:"vtc,omitempty"`
+	PO       string   `xml:"po,attr" json:"post_office,omitempty"`
+	District string   `xml:"dist,attr" json:"district,omitempty"`
+	SubDist  string   `xml:"subdist,attr" json:"sub_district,omitempty"`
+	State    string   `xml:"state,attr" json:"state,omitempty"`
+	Pincode  string   `xml:"pc,attr" json:"pincode,omitempty"`
+
+	Address      Address `xml:"-" json:"address"`
+	Demographics `xml:"-"`
+}
+
+// ParseLegacyQR parses the old Aadhaar letter XML QR. The UID is checked
+// with the Verhoeff checksum and masked to its last 4 digits unless
+// revealUID is set.
+func ParseLegacyQR(data []byte, revealUID bool) (*LegacyQR, error) {
+	// Scanners sometimes prepend a BOM or stray bytes before the XML.
+	start := xmlStart(data)
+	if start < 0 {
+		return nil, fmt.Errorf("legacy QR: no XML found")
+	}
+
+	var q LegacyQR
+	if err := xml.Unmarshal(data[start:], &q); err != nil {
+		return nil, fmt.Errorf("legacy QR: XML parse error: %v", err)
+	}
+
+	q.UID = strings.TrimSpace(q.UID)
+	if q.UID == "" {
+		return nil, fmt.Errorf("legacy QR: missing uid")
+	}
+	q.UIDValid = ValidAadhaarNumber(q.UID)
+	if !revealUID {
+		q.UID = MaskAadhaar(q.UID)
+	}
+
+	// Older letters only print the year of birth.
+	q.Demographics = NewDemographics(firstNonEmpty(q.DOB, q.YOB), q.Gender)
+	q.Address = Address{
+		CareOf:      q.CareOf,
+		House:       q.House,
+		Street:      q.Street,
+		Landmark:    q.Landmark,
+		Locality:    q.Locality,
+		VTC:         q.VTC,
+		PostOffice:  q.PO,
+		SubDistrict: q.SubDist,
+		District:    q.District,
+		State:       q.State,
+		Pincode:     q.Pincode,
+	}.normalize()
+
+	return &q, nil
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidShareCode is returned for share codes that are not 4 digits.
+var ErrInvalidShareCode = errors.New("share code must be 4 digits")
+
+// offlineKycXML is the wire layout of OfflinePaperlessKyc: resident data
+// nested in UidData, with Poi/Poa attributes. Older Secure QR XML puts
+// Poi and Poa directly under the root and uses co/lm for careof/landmark.
+type offlineKycXML struct {
+	ReferenceID string            `xml:"referenceId,attr"`
+	UidData     offlineKycUidData `xml:"UidData"`
+	offlineKycUidData
+}
+
+type offlineKycUidData struct {
+	Poi struct {
+		Name   string `xml:"name,attr"`
+		Gender string `xml:"gender,attr"`
+		DOB    string `xml:"dob,attr"`
+		Phone  string `xml:"phone,attr"`
+		Email  string `xml:"email,attr"`
+		// Hashed mobile and email
+		MobileHash string `xml:"m,attr"`
+		EmailHash  string `xml:"e,attr"`
+	} `xml:"Poi"`
+	Poa struct {
+		CareOf      string `xml:"careof,attr"`
+		CO          string `xml:"co,attr"`
+		House       string `xml:"house,attr"`
+		Street      string `xml:"street,attr"`
+		Landmark    string `xml:"landmark,attr"`
+		LM          string `xml:"lm,attr"`
+		Locality    string `xml:"loc,attr"`
+		VTC         string `xml:"vtc,attr"`
+		SubDistrict string `xml:"subdist,attr"`
+		District    string `xml:"dist,attr"`
+		State       string `xml:"state,attr"`
+		Pincode     string `xml:"pc,attr"`
+		PostOffice  string `xml:"po,attr"`
+		Country     string `xml:"country,attr"`
+	} `xml:"Poa"`
+	Pht string `xml:"Pht"`
+}
+
+// UnmarshalXML maps the nested Poi/Poa attributes onto the flat struct;
+// encoding/xml cannot express attributes of child elements in tags.
+func (k *AadhaarOfflineKyc) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if start.Name.Local != "OfflinePaperlessKyc" {
+		return fmt.Errorf("expected element OfflinePaperlessKyc, got %s", start.Name.Local)
+	}
+	var raw offlineKycXML
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	data := raw.UidData
+	if data.Poi.Name == "" && data.Pht == "" {
+		data = raw.offlineKycUidData
+	}
+
+	*k = AadhaarOfflineKyc{
+		XMLName:     start.Name,
+		ReferenceID: raw.ReferenceID,
+		Name:        data.Poi.Name,
+		Gender:      data.Poi.Gender,
+		DOB:         data.Poi.DOB,
+		Phone:       data.Poi.Phone,
+		Email:       data.Poi.Email,
+		MobileHash:  data.Poi.MobileHash,
+		EmailHash:   data.Poi.EmailHash,
+		CO:          firstNonEmpty(data.Poa.CareOf, data.Poa.CO),
+		House:       data.Poa.House,
+		Street:      data.Poa.Street,
+		Landmark:    firstNonEmpty(data.Poa.Landmark, data.Poa.LM),
+		Locality:    data.Poa.Locality,
+		VTC:         data.Poa.VTC,
+		SubDistrict: data.Poa.SubDistrict,
+		District:    data.Poa.District,
+		State:       data.Poa.State,
+		Pincode:     data.Poa.Pincode,
+		PostOffice:  data.Poa.PostOffice,
+		Country:     data.Poa.Country,
+	}
+	// A malformed referenceId is kept as is; only the split is skipped.
+	k.AadhaarLast4, k.GeneratedAt, _ = ParseReferenceID(raw.ReferenceID)
+
+	if pht := strings.Join(strings.Fields(data.Pht), ""); pht != "" {
+		photo, err := base64.StdEncoding.DecodeString(pht)
+		if err != nil {
+			return fmt.Errorf("Pht: %v", err)
+		}
+		k.Photo = photo
+	}
+	return nil
+}
+
+// referenceIDZone is the zone of referenceId timestamps: UIDAI generates
+// documents in IST.
+var referenceIDZone = time.FixedZone("IST", 5*60*60+30*60)
+
+// ParseReferenceID splits an offline e-KYC referenceId into the last 4
+// Aadhaar digits and the generation time, encoded as yyyyMMddHHmmssSSS.
+func ParseReferenceID(ref string) (string, time.Time, error) {
+	ref = strings.TrimSpace(ref)
+	if len(ref) != 4+17 || !isDecimal([]byte(ref)) {
+		return "", time.Time{}, fmt.Errorf("invalid referenceId %q", ref)
+	}
+	ts, err := time.ParseInLocation("20060102150405", ref[4:18], referenceIDZone)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("referenceId timestamp: %v", err)
+	}
+	ms, _ := strconv.Atoi(ref[18:])
+	return ref[:4], ts.Add(time.Duration(ms) * time.Millisecond), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ParseOfflineKYCXML parses an OfflinePaperlessKyc XML document into the
+// same shape the Secure QR XML path returns.
+func ParseOfflineKYCXML(xmlBytes []byte, pub *rsa.PublicKey) (*AadhaarSecureQR, error) {
+	var kyc AadhaarOfflineKyc
+	if err := xml.Unmarshal(xmlBytes, &kyc); err != nil {
+		return nil, fmt.Errorf("XML parse error: %v", err)
+	}
+
+	addr := kyc.Address()
+	q := &AadhaarSecureQR{
+		XML:          kyc,
+		Photo:        kyc.Photo,
+		RawXML:       string(xmlBytes),
+		Reference:    kyc.ReferenceID,
+		AadhaarLast4: kyc.AadhaarLast4,
+		GeneratedAt:  kyc.GeneratedAt,
+		Name:         kyc.Name,
+		Gender:       kyc.Gender,
+		DOB:          kyc.DOB,
+		Address:      addr,
+		FullAddr:     addr.SingleLine(),
+		Demographics: NewDemographics(kyc.DOB, kyc.Gender),
+	}
+
+	q.setSignature(VerifyXMLDSig(xmlBytes, pub))
+	return q, nil
+}
+
+// setSignature records the outcome of verifying q's signature. Like the
+// Secure QR parsers, a bad signature is reported in the result rather
+// than as an error.
+func (q *AadhaarSecureQR) setSignature(err error) {
+	if err == nil {
+		q.Valid = true
+		return
+	}
+	log.Println("[xmldsig]", err)
+	var dsigErr *XMLDSigError
+	if errors.As(err, &dsigErr) {
+		q.SignatureStep = dsigErr.Step
+	}
+	q.SignatureError = err.Error()
+}
+
+// ParseOfflineKYCZip opens an Offline Paperless e-KYC ZIP downloaded from
+// UIDAI with its 4-digit share code and parses the XML inside.
+func ParseOfflineKYCZip(zipBytes []byte, shareCode string, pub *rsa.PublicKey) (*ParseResult, error) {
+	shareCode = strings.TrimSpace(shareCode)
+	if len(shareCode) != 4 || !isDecimal([]byte(shareCode)) {
+		return nil, ErrInvalidShareCode
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ZIP: %v", err)
+	}
+
+	var entry *zip.File
+	for _, f := range zr.File {
+		if strings.EqualFold(path.Ext(f.Name), ".xml") {
+			entry = f
+			break
+		}
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("no XML file in ZIP")
+	}
+
+	xmlBytes, err := readZipEntry(entry, []byte(shareCode))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", entry.Name, err)
+	}
+
+	q, err := ParseOfflineKYCXML(xmlBytes, pub)
+	if err != nil {
+		return nil, err
+	}
+	return &ParseResult{
+		Info: FormatInfo{Format: FormatOfflineKYC, Confidence: 1,
+			Reason: "share code protected ZIP with OfflinePaperlessKyc XML"},
+		Type:  string(FormatOfflineKYC),
+		Data:  q,
+		Photo: q.Photo,
+	}, nil
+}
+
+// Address returns the Poa components as an Address.
+func (k AadhaarOfflineKyc) Address() Address {
+	return Address{
+		CareOf:      k.CO,
+		House:       k.House,
+		Street:      k.Street,
+		Landmark:    k.Landmark,
+		Locality:    k.Locality,
+		VTC:         k.VTC,
+		PostOffice:  k.PostOffice,
+		SubDistrict: k.SubDistrict,
+		District:    k.District,
+		State:       k.State,
+		Pincode:     k.Pincode,
+		Country:     k.Country,
+	}.normalize()
+}
@@ -2,10 +2,8 @@ package services
 
 import (
 	"bytes"
-	"compress/gzip"
 	"errors"
-	"io"
-	"math/big"
+	"fmt"
 )
 
 type SecureQRV1 struct {
@@ -15,46 +13,35 @@ type SecureQRV1 struct {
 	ReferenceID string `json:"reference_id"`
 	MobileHash  string `json:"mobile_hash"`
 	EmailHash   string `json:"email_hash"`
+	Demographics
 }
 
 func ParseSecureQRV1(raw []byte, _ interface{}) (*SecureQRV1, error) {
 
-	// 1️⃣ Decimal → bytes
-	bi := new(big.Int)
-	if _, ok := bi.SetString(string(raw), 10); !ok {
-		return nil, errors.New("invalid decimal QR")
-	}
-	compressed := bi.Bytes()
-
-	// Must be GZIP
-	if len(compressed) < 3 || compressed[0] != 0x1f || compressed[1] != 0x8b {
-		return nil, errors.New("QR is not GZIP - not SecureQRV1")
-	}
-
-	// 2️⃣ GZIP decompress
-	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	// 1️⃣ Decimal → bytes → gunzip
+	unzipped, err := inflateDecimal(raw)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("V1: %v", err)
 	}
-	defer gz.Close()
 
-	unzipped, err := io.ReadAll(gz)
-	if err != nil {
-		return nil, err
-	}
+	return parseSecureQRV1Data(unzipped)
+}
 
-	// 3️⃣ Split fields
+func parseSecureQRV1Data(unzipped []byte) (*SecureQRV1, error) {
+	// 2️⃣ Split fields
 	parts := bytes.Split(unzipped, []byte("\n"))
 	if len(parts) < 6 {
 		return nil, errors.New("invalid V1 text block")
 	}
 
-	return &SecureQRV1{
+	q := &SecureQRV1{
 		Name:        string(parts[0]),
 		DOB:         string(parts[1]),
 		Gender:      string(parts[2]),
 		ReferenceID: string(parts[3]),
 		MobileHash:  string(parts[4]),
 		EmailHash:   string(parts[5]),
-	}, nil
+	}
+	q.Demographics = NewDemographics(q.DOB, q.Gender)
+	return q, nil
 }
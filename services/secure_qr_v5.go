@@ -2,103 +2,190 @@ package services
 
 import (
 	"bytes"
-	"compress/gzip"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
-	"math/big"
+	"strings"
+)
+
+const (
+	secureQRSignatureLen = 256
+	secureQRHashLen      = 32
+	secureQRDelimiter    = 0xFF
+
+	// Text fields before the photo: the unversioned format starts at the
+	// email/mobile indicator, V2 onwards prefix a version field and append
+	// the last 4 digits of the registered mobile.
+	secureQRLegacyFields    = 16
+	secureQRVersionedFields = 18
+)
+
+// Email/mobile indicator values from the UIDAI Secure QR specification.
+const (
+	SecureQRNoContact   = 0
+	SecureQREmailOnly   = 1
+	SecureQRMobileOnly  = 2
+	SecureQREmailMobile = 3
 )
 
 type SecureQRV5 struct {
-	Version      string `json:"version"`
-	ReferenceID  string `json:"reference_id"`
-	Name         string `json:"name"`
-	DOB          string `json:"dob"`
-	Gender       string `json:"gender"`
-	CareOf       string `json:"care_of"`
-	District     string `json:"district"`
-	PostOffice   string `json:"post_office"`
-	Pincode      string `json:"pincode"`
-	VTC          string `json:"vtc"`
-	State        string `json:"state"`
-	SubDistrict  string `json:"sub_district"`
-	Location     string `json:"location"`
-	MaskedMobile string `json:"masked_mobile"`
-	MaskedEmail  string `json:"masked_email,omitempty"`
-	RawText      string `json:"raw_text"`
+	Version        string `json:"version"`
+	Indicator      int    `json:"email_mobile_indicator"`
+	ReferenceID    string `json:"reference_id"`
+	AadhaarLast4   string `json:"aadhaar_last4,omitempty"`
+	Name           string `json:"name"`
+	DOB            string `json:"dob"`
+	Gender         string `json:"gender"`
+	CareOf         string `json:"care_of"`
+	District       string `json:"district"`
+	Landmark       string `json:"landmark"`
+	House          string `json:"house"`
+	Location       string `json:"location"`
+	Pincode        string `json:"pincode"`
+	PostOffice     string `json:"post_office"`
+	State          string `json:"state"`
+	Street         string `json:"street"`
+	SubDistrict    string `json:"sub_district"`
+	VTC            string `json:"vtc"`
+	MaskedMobile   string `json:"masked_mobile,omitempty"`
+	MobileHash     string `json:"mobile_hash,omitempty"`
+	EmailHash      string `json:"email_hash,omitempty"`
+	Photo          []byte `json:"photo,omitempty"`
+	SignatureValid bool   `json:"signature_valid"`
+	RawText        string `json:"raw_text"`
+
+	// Address and DOB/gender normalized from the fields above.
+	Address Address `json:"address"`
+	Demographics
 }
 
-func ParseSecureQRV5(raw []byte) (*SecureQRV5, error) {
+// ParseSecureQRV5 parses a UIDAI Secure QR (unversioned and V2 through V5):
+// a big decimal number wrapping gzip data that holds 0xFF separated text
+// fields, the JPEG2000 photo, optional email/mobile hashes and a trailing
+// RSA-SHA256 signature. The signature is checked against pub; a nil key or
+// a bad signature is reported through SignatureValid, not as an error.
+func ParseSecureQRV5(raw []byte, pub *rsa.PublicKey) (*SecureQRV5, error) {
 
-	// 1️⃣ Convert decimal → big.Int → bytes
-	bi := new(big.Int)
-	if _, ok := bi.SetString(string(raw), 10); !ok {
-		return nil, errors.New("V5: input is not decimal")
+	// 1️⃣ decimal → bytes → gunzip
+	unzipped, err := inflateDecimal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("V5: %v", err)
 	}
-	zipped := bi.Bytes()
 
-	// Must begin with GZIP magic
-	if len(zipped) < 2 || zipped[0] != 0x1f || zipped[1] != 0x8b {
-		return nil, errors.New("V5: not gzip data")
-	}
+	return parseSecureQRData(unzipped, pub)
+}
 
-	// 2️⃣ GZIP decompress
-	gz, err := gzip.NewReader(bytes.NewReader(zipped))
-	if err != nil {
-		return nil, fmt.Errorf("V5: gunzip error: %w", err)
+func parseSecureQRData(data []byte, pub *rsa.PublicKey) (*SecureQRV5, error) {
+	if len(data) < secureQRSignatureLen {
+		return nil, fmt.Errorf("V5: payload too short for signature (%d bytes)", len(data))
 	}
-	defer gz.Close()
 
-	unzipped, err := io.ReadAll(gz)
-	if err != nil {
-		return nil, fmt.Errorf("V5: read error: %w", err)
+	// 3️⃣ Text fields, split by 0xFF (UIDAI field delimiter). The photo
+	// follows the last text field and may itself contain 0xFF, so only
+	// the known number of fields is split off.
+	numFields := secureQRLegacyFields
+	if len(data) > 1 && data[0] == 'V' && data[1] >= '0' && data[1] <= '9' {
+		numFields = secureQRVersionedFields
 	}
 
-	// 3️⃣ Split by 0xFF (UIDAI field delimiter)
-	parts := bytes.Split(unzipped, []byte{0xFF})
+	fields := make([]string, 0, numFields)
+	pos := 0
+	for len(fields) < numFields {
+		i := bytes.IndexByte(data[pos:], secureQRDelimiter)
+		if i < 0 {
+			return nil, fmt.Errorf("V5: insufficient fields (%d)", len(fields))
+		}
+		fields = append(fields, string(data[pos:pos+i]))
+		pos += i + 1
+	}
+	text := data[:pos]
 
-	// Clean empty entries (UIDAI often leaves empty fields)
-	clean := make([]string, 0)
-	for _, p := range parts {
-		clean = append(clean, string(p))
+	off := 0
+	model := &SecureQRV5{RawText: string(bytes.TrimRight(text, "\xff"))}
+	if numFields == secureQRVersionedFields {
+		model.Version = fields[0]
+		model.MaskedMobile = fields[17]
+		off = 1
 	}
 
-	// Must have at least 18 meaningful fields
-	if len(clean) < 18 {
-		return nil, fmt.Errorf("V5: insufficient fields (%d)", len(clean))
+	indicator := strings.TrimSpace(fields[off])
+	if len(indicator) != 1 || indicator[0] < '0' || indicator[0] > '3' {
+		return nil, fmt.Errorf("V5: invalid email/mobile indicator %q", indicator)
 	}
+	model.Indicator = int(indicator[0] - '0')
 
-	// 4️⃣ Map fields based on official UIDAI V5 layout
-	model := &SecureQRV5{
-		Version:      clean[0],
-		ReferenceID:  safe(clean, 2),
-		Name:         safe(clean, 3),
-		DOB:          safe(clean, 4),
-		Gender:       safe(clean, 5),
-		CareOf:       safe(clean, 6),
-		District:     safe(clean, 7),
-		PostOffice:   safe(clean, 9),
-		Pincode:      safe(clean, 11),
-		VTC:          safe(clean, 12),
-		State:        safe(clean, 13),
-		SubDistrict:  safe(clean, 14),
-		Location:     safe(clean, 16),
-		MaskedMobile: safe(clean, 17),
-		RawText:      string(unzipped),
+	// 4️⃣ Map fields based on official UIDAI layout
+	model.ReferenceID = fields[off+1]
+	model.Name = fields[off+2]
+	model.DOB = fields[off+3]
+	model.Gender = fields[off+4]
+	model.CareOf = fields[off+5]
+	model.District = fields[off+6]
+	model.Landmark = fields[off+7]
+	model.House = fields[off+8]
+	model.Location = fields[off+9]
+	model.Pincode = fields[off+10]
+	model.PostOffice = fields[off+11]
+	model.State = fields[off+12]
+	model.Street = fields[off+13]
+	model.SubDistrict = fields[off+14]
+	model.VTC = fields[off+15]
+	model.Address = Address{
+		CareOf:      model.CareOf,
+		House:       model.House,
+		Street:      model.Street,
+		Landmark:    model.Landmark,
+		Locality:    model.Location,
+		VTC:         model.VTC,
+		PostOffice:  model.PostOffice,
+		SubDistrict: model.SubDistrict,
+		District:    model.District,
+		State:       model.State,
+		Pincode:     model.Pincode,
+	}.normalize()
+	model.Demographics = NewDemographics(model.DOB, model.Gender)
+	if len(model.ReferenceID) >= 4 {
+		model.AadhaarLast4 = model.ReferenceID[:4]
 	}
 
-	// 5️⃣ Optional masked email (not always present)
-	if len(clean) > 18 {
-		model.MaskedEmail = clean[18]
+	// 5️⃣ Tail: [photo][email hash][mobile hash][signature]
+	sigStart := len(data) - secureQRSignatureLen
+	if sigStart < pos {
+		return nil, fmt.Errorf("V5: payload too short for signature after text fields")
 	}
+	tail := sigStart
+	if model.Indicator == SecureQRMobileOnly || model.Indicator == SecureQREmailMobile {
+		tail -= secureQRHashLen
+		if tail < pos {
+			return nil, fmt.Errorf("V5: payload too short for mobile hash")
+		}
+		model.MobileHash = hex.EncodeToString(data[tail : tail+secureQRHashLen])
+	}
+	if model.Indicator == SecureQREmailOnly || model.Indicator == SecureQREmailMobile {
+		tail -= secureQRHashLen
+		if tail < pos {
+			return nil, fmt.Errorf("V5: payload too short for email hash")
+		}
+		model.EmailHash = hex.EncodeToString(data[tail : tail+secureQRHashLen])
+	}
+	model.Photo = data[pos:tail]
+
+	// 6️⃣ RSA-SHA256 over everything before the signature
+	model.SignatureValid = verifySecureQRSignature(data[:sigStart], data[sigStart:], pub) == nil
 
 	return model, nil
 }
 
-// protects from index out of range
-func safe(arr []string, idx int) string {
-	if idx >= len(arr) {
-		return ""
+func verifySecureQRSignature(signed, signature []byte, pub *rsa.PublicKey) error {
+	if pub == nil {
+		return errors.New("no UIDAI public key loaded")
+	}
+	hash := sha256.Sum256(signed)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature); err != nil {
+		return fmt.Errorf("signature verification failed: %v", err)
 	}
-	return arr[idx]
+	return nil
 }
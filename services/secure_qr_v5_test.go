@@ -0,0 +1,200 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// secureQRFields are the text fields from the email/mobile indicator to
+// VTC, with the indicator left out.
+var secureQRFields = []string{
+	"123420240101120000123", "Ravi Kumar", "01-01-1990", "M", "S/O: Mohan",
+	"Pune", "Near  Temple", "12", "Kothrud", "411038", "Kothrud", "Maharashtra",
+	"MG Road", "Haveli", "Pune",
+}
+
+// secureQRData lays out decompressed Secure QR data: the version field if
+// version is set, the text fields, the masked mobile for versioned
+// layouts, then photo, the hashes and a signature by key (zeros if nil).
+func secureQRData(t *testing.T, version string, indicator byte, photo, emailHash, mobileHash []byte, key *rsa.PrivateKey) []byte {
+	t.Helper()
+	var fields []string
+	if version != "" {
+		fields = append(fields, version)
+	}
+	fields = append(fields, string(indicator))
+	fields = append(fields, secureQRFields...)
+	if version != "" {
+		fields = append(fields, "9876")
+	}
+
+	var b bytes.Buffer
+	for _, f := range fields {
+		b.WriteString(f)
+		b.WriteByte(secureQRDelimiter)
+	}
+	b.Write(photo)
+	b.Write(emailHash)
+	b.Write(mobileHash)
+	signature := make([]byte, secureQRSignatureLen)
+	if key != nil {
+		hash := sha256.Sum256(b.Bytes())
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Write(signature)
+	return b.Bytes()
+}
+
+func TestParseSecureQRData(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A JPEG2000 codestream starts with FF 4F FF 51: the photo holds the
+	// field delimiter.
+	photo := []byte{0xFF, 0x4F, 0xFF, 0x51, 0x00, 0x2F, 0xFF, 0xD9}
+	email := bytes.Repeat([]byte{0xEE}, secureQRHashLen)
+	mobile := bytes.Repeat([]byte{0x11}, secureQRHashLen)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantVer    string
+		wantInd    int
+		wantEmail  []byte
+		wantMobile []byte
+		wantMasked string
+	}{
+		{name: "unversioned", data: secureQRData(t, "", '3', photo, email, mobile, key), wantInd: SecureQREmailMobile, wantEmail: email, wantMobile: mobile},
+		{name: "V2 email and mobile", data: secureQRData(t, "V2", '3', photo, email, mobile, key), wantVer: "V2", wantInd: SecureQREmailMobile, wantEmail: email, wantMobile: mobile, wantMasked: "9876"},
+		{name: "V3 no contact", data: secureQRData(t, "V3", '0', photo, nil, nil, key), wantVer: "V3", wantInd: SecureQRNoContact, wantMasked: "9876"},
+		{name: "V4 email only", data: secureQRData(t, "V4", '1', photo, email, nil, key), wantVer: "V4", wantInd: SecureQREmailOnly, wantEmail: email, wantMasked: "9876"},
+		{name: "V5 mobile only", data: secureQRData(t, "V5", '2', photo, nil, mobile, key), wantVer: "V5", wantInd: SecureQRMobileOnly, wantMobile: mobile, wantMasked: "9876"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseSecureQRData(tt.data, &key.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Version != tt.wantVer || q.Indicator != tt.wantInd || q.MaskedMobile != tt.wantMasked {
+				t.Errorf("version %q, indicator %d, masked mobile %q", q.Version, q.Indicator, q.MaskedMobile)
+			}
+			if q.ReferenceID != "123420240101120000123" || q.AadhaarLast4 != "1234" || q.Name != "Ravi Kumar" ||
+				q.DOB != "01-01-1990" || q.CareOf != "S/O: Mohan" || q.VTC != "Pune" || q.SubDistrict != "Haveli" {
+				t.Errorf("fields = %+v", q)
+			}
+			if q.Sex != GenderMale || q.BirthDate == nil {
+				t.Errorf("demographics = %+v", q.Demographics)
+			}
+			if q.Address.Landmark != "Near Temple" || q.Address.Pincode != "411038" || !q.Address.PincodeValid {
+				t.Errorf("address = %+v", q.Address)
+			}
+			if !bytes.Equal(q.Photo, photo) {
+				t.Errorf("photo = %x, want %x", q.Photo, photo)
+			}
+			if q.EmailHash != hex.EncodeToString(tt.wantEmail) || q.MobileHash != hex.EncodeToString(tt.wantMobile) {
+				t.Errorf("email hash %q, mobile hash %q", q.EmailHash, q.MobileHash)
+			}
+			if !q.SignatureValid {
+				t.Error("signature not valid")
+			}
+			// RawText is the text fields up to, not including, the
+			// delimiter before the photo.
+			if strings.HasSuffix(q.RawText, "\xff") || !bytes.HasPrefix(tt.data, append([]byte(q.RawText+"\xff"), photo...)) {
+				t.Errorf("RawText = %q", q.RawText)
+			}
+		})
+	}
+}
+
+func TestParseSecureQRDataSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := secureQRData(t, "V2", '0', []byte("photo"), nil, nil, key)
+	tampered := bytes.Replace(signed, []byte("Mohan"), []byte("Mohit"), 1)
+
+	tests := []struct {
+		name string
+		data []byte
+		pub  *rsa.PublicKey
+		want bool
+	}{
+		{"valid", signed, &key.PublicKey, true},
+		{"no key", signed, nil, false},
+		{"wrong key", signed, &other.PublicKey, false},
+		{"tampered", tampered, &key.PublicKey, false},
+		{"unsigned", secureQRData(t, "V2", '0', []byte("photo"), nil, nil, nil), &key.PublicKey, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseSecureQRData(tt.data, tt.pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.SignatureValid != tt.want {
+				t.Errorf("SignatureValid = %v, want %v", q.SignatureValid, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSecureQRDataErrors(t *testing.T) {
+	longName := bytes.Replace(secureQRData(t, "V2", '0', nil, nil, nil, nil), []byte("Ravi Kumar"), bytes.Repeat([]byte("R"), 300), 1)
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"shorter than a signature", []byte("V2\xff3\xff1234"), "too short for signature"},
+		{"missing fields", append([]byte("V2\xff3\xff1234\xffRavi\xff"), make([]byte, secureQRSignatureLen)...), "insufficient fields"},
+		{"text fields run into the signature", longName[:len(longName)-200], "too short for signature after text fields"},
+		{"bad indicator", secureQRData(t, "V2", '7', nil, nil, nil, nil), "invalid email/mobile indicator"},
+		{"no room for mobile hash", secureQRData(t, "V2", '2', nil, nil, nil, nil), "too short for mobile hash"},
+		{"no room for email hash", secureQRData(t, "V2", '3', nil, nil, make([]byte, secureQRHashLen), nil), "too short for email hash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseSecureQRData(tt.data, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %+v, %v; want %q", q, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSecureQRV5(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := secureQRData(t, "V5", '0', []byte("photo"), nil, nil, key)
+	q, err := ParseSecureQRV5(decimalQR(data), &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Version != "V5" || q.Name != "Ravi Kumar" || !q.SignatureValid {
+		t.Errorf("got %+v", q)
+	}
+
+	for _, raw := range []string{"", "12a4", "123456789"} {
+		if _, err := ParseSecureQRV5([]byte(raw), nil); err == nil || !strings.HasPrefix(err.Error(), "V5: ") {
+			t.Errorf("ParseSecureQRV5(%q): err = %v, want V5 error", raw, err)
+		}
+	}
+}
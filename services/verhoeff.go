@@ -0,0 +1,63 @@
+package services
+
+// Verhoeff tables (dihedral group D5 multiplication, permutation).
+var (
+	verhoeffD = [10][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffP = [8][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// ValidVerhoeff reports whether num is all digits and its last digit is
+// a correct Verhoeff check digit, as used by Aadhaar numbers.
+func ValidVerhoeff(num string) bool {
+	if num == "" {
+		return false
+	}
+	c := 0
+	for i := 0; i < len(num); i++ {
+		ch := num[len(num)-1-i]
+		if ch < '0' || ch > '9' {
+			return false
+		}
+		c = verhoeffD[c][verhoeffP[i%8][ch-'0']]
+	}
+	return c == 0
+}
+
+// ValidAadhaarNumber checks the 12 digit format, the rule that Aadhaar
+// numbers never start with 0 or 1, and the Verhoeff checksum.
+func ValidAadhaarNumber(uid string) bool {
+	return len(uid) == 12 && uid[0] >= '2' && ValidVerhoeff(uid)
+}
+
+// MaskAadhaar hides all but the last 4 digits of an Aadhaar number.
+func MaskAadhaar(uid string) string {
+	if len(uid) <= 4 {
+		return uid
+	}
+	masked := make([]byte, len(uid))
+	for i := range masked {
+		masked[i] = 'X'
+	}
+	copy(masked[len(uid)-4:], uid[len(uid)-4:])
+	return string(masked)
+}
@@ -0,0 +1,89 @@
+package services
+
+import "testing"
+
+// verhoeffValid are numbers with a correct check digit: the published
+// examples 236-3, 12345-1, 142857-0, 123456789012-0 and
+// 8473643095483728456789-2, and Aadhaar numbers from UIDAI samples.
+var verhoeffValid = []string{
+	"2363",
+	"123451",
+	"1428570",
+	"1234567890120",
+	"84736430954837284567892",
+	"0",
+	"234123412346",
+	"999941057058",
+	"499118665246",
+}
+
+func TestValidVerhoeff(t *testing.T) {
+	for _, num := range verhoeffValid {
+		if !ValidVerhoeff(num) {
+			t.Errorf("ValidVerhoeff(%q) = false", num)
+		}
+		// Verhoeff catches every single-digit error and every transposition
+		// of adjacent digits.
+		for i := range num {
+			for c := byte('0'); c <= '9'; c++ {
+				if c == num[i] {
+					continue
+				}
+				typo := num[:i] + string(c) + num[i+1:]
+				if ValidVerhoeff(typo) {
+					t.Errorf("ValidVerhoeff(%q) = true (typo of %s)", typo, num)
+				}
+			}
+			if i+1 < len(num) && num[i] != num[i+1] {
+				swapped := num[:i] + string(num[i+1]) + string(num[i]) + num[i+2:]
+				if ValidVerhoeff(swapped) {
+					t.Errorf("ValidVerhoeff(%q) = true (transposition of %s)", swapped, num)
+				}
+			}
+		}
+	}
+
+	for _, num := range []string{"", "2364", "23 63", "2363 ", "-2363", "23a3", "１２３４５１"} {
+		if ValidVerhoeff(num) {
+			t.Errorf("ValidVerhoeff(%q) = true", num)
+		}
+	}
+}
+
+func TestValidAadhaarNumber(t *testing.T) {
+	tests := []struct {
+		uid  string
+		want bool
+	}{
+		{"234123412346", true},
+		{"999941057058", true},
+		{"499118665246", true},
+		{"234123412345", false}, // wrong check digit
+		{"123456789010", false}, // Verhoeff-valid, starts with 1
+		{"014285700009", false}, // Verhoeff-valid, starts with 0
+		{"23412341235", false},  // Verhoeff-valid, 11 digits
+		{"2341234123460", false},
+		{"2341 2341 2346", false},
+		{"XXXXXXXX2346", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidAadhaarNumber(tt.uid); got != tt.want {
+			t.Errorf("ValidAadhaarNumber(%q) = %v, want %v", tt.uid, got, tt.want)
+		}
+	}
+}
+
+func TestMaskAadhaar(t *testing.T) {
+	tests := []struct{ uid, want string }{
+		{"234123412346", "XXXXXXXX2346"},
+		{"12345", "X2345"},
+		{"2346", "2346"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := MaskAadhaar(tt.uid); got != tt.want {
+			t.Errorf("MaskAadhaar(%q) = %q, want %q", tt.uid, got, tt.want)
+		}
+	}
+}
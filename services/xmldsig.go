@@ -0,0 +1,578 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	dsigNS = "http://www.w3.org/2000/09/xmldsig#"
+	xmlNS  = "http://www.w3.org/XML/1998/namespace"
+
+	algC14N            = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	algC14NComments    = algC14N + "#WithComments"
+	algC14N11          = "http://www.w3.org/2006/12/xml-c14n11"
+	algC14N11Comments  = algC14N11 + "#WithComments"
+	algExcC14N         = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algExcC14NComments = algExcC14N + "WithComments"
+	algEnveloped       = dsigNS + "enveloped-signature"
+
+	algSHA1   = dsigNS + "sha1"
+	algSHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512 = "http://www.w3.org/2001/04/xmlenc#sha512"
+
+	algRSASHA1   = dsigNS + "rsa-sha1"
+	algRSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+)
+
+// Steps of XML signature verification, reported in XMLDSigError.
+const (
+	XMLDSigStepParse          = "parse"
+	XMLDSigStepSignature      = "signature_element"
+	XMLDSigStepReference      = "reference"
+	XMLDSigStepTransform      = "transform"
+	XMLDSigStepDigest         = "digest"
+	XMLDSigStepKey            = "key"
+	XMLDSigStepSignatureValue = "signature_value"
+)
+
+// XMLDSigError says which verification step rejected the document.
+type XMLDSigError struct {
+	Step string
+	Err  error
+}
+
+func (e *XMLDSigError) Error() string {
+	return fmt.Sprintf("XML signature %s check failed: %v", e.Step, e.Err)
+}
+
+func (e *XMLDSigError) Unwrap() error { return e.Err }
+
+// ErrNoXMLSignature is wrapped by the XMLDSigError for a document that
+// carries no enveloped Signature at all.
+var ErrNoXMLSignature = errors.New("no Signature element")
+
+func dsigErr(step string, format string, args ...interface{}) error {
+	return &XMLDSigError{Step: step, Err: fmt.Errorf(format, args...)}
+}
+
+// VerifyXMLDSig verifies the enveloped XML Digital Signature of doc
+// (Offline e-KYC XML): every Reference digest over the canonicalized,
+// transformed content, then the RSA SignatureValue over the canonicalized
+// SignedInfo. Keys embedded in KeyInfo are ignored; only pub is trusted.
+func VerifyXMLDSig(doc []byte, pub *rsa.PublicKey) error {
+	root, err := parseXMLTree(doc)
+	if err != nil {
+		return &XMLDSigError{Step: XMLDSigStepParse, Err: err}
+	}
+
+	sig := root.find(func(n *xmlNode) bool { return n.is(dsigNS, "Signature") })
+	if sig == nil {
+		return &XMLDSigError{Step: XMLDSigStepSignature, Err: ErrNoXMLSignature}
+	}
+	signedInfo := sig.child(dsigNS, "SignedInfo")
+	if signedInfo == nil {
+		return dsigErr(XMLDSigStepSignature, "no SignedInfo element")
+	}
+	c14nMethod := signedInfo.child(dsigNS, "CanonicalizationMethod")
+	sigMethod := signedInfo.child(dsigNS, "SignatureMethod")
+	sigValue := sig.child(dsigNS, "SignatureValue")
+	if c14nMethod == nil || sigMethod == nil || sigValue == nil {
+		return dsigErr(XMLDSigStepSignature, "incomplete Signature element")
+	}
+
+	refs := signedInfo.children(dsigNS, "Reference")
+	if len(refs) == 0 {
+		return dsigErr(XMLDSigStepReference, "no Reference element")
+	}
+	for _, ref := range refs {
+		if err := verifyReference(root, sig, ref); err != nil {
+			return err
+		}
+	}
+
+	if pub == nil {
+		return dsigErr(XMLDSigStepKey, "no UIDAI public key loaded")
+	}
+
+	canon, err := newC14N(c14nMethod, false)
+	if err != nil {
+		return &XMLDSigError{Step: XMLDSigStepSignatureValue, Err: err}
+	}
+	var hash crypto.Hash
+	switch alg := sigMethod.attr("", "Algorithm"); alg {
+	case algRSASHA1:
+		hash = crypto.SHA1
+	case algRSASHA256:
+		hash = crypto.SHA256
+	case algRSASHA512:
+		hash = crypto.SHA512
+	default:
+		return dsigErr(XMLDSigStepSignatureValue, "unsupported signature method %q", alg)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(sigValue.textContent()), ""))
+	if err != nil {
+		return dsigErr(XMLDSigStepSignatureValue, "bad base64: %v", err)
+	}
+
+	h := hash.New()
+	h.Write(canon.canonicalize(signedInfo))
+	if err := rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), signature); err != nil {
+		return dsigErr(XMLDSigStepSignatureValue, "%v", err)
+	}
+	return nil
+}
+
+func verifyReference(root, sig, ref *xmlNode) error {
+	uri := ref.attr("", "URI")
+	var target *xmlNode
+	switch {
+	case uri == "":
+		target = root
+	case strings.HasPrefix(uri, "#"):
+		id := uri[1:]
+		target = root.find(func(n *xmlNode) bool {
+			return n.attr("", "Id") == id || n.attr("", "ID") == id || n.attr("", "id") == id
+		})
+		if target == nil {
+			return dsigErr(XMLDSigStepReference, "no element with Id %q", id)
+		}
+	default:
+		return dsigErr(XMLDSigStepReference, "unsupported Reference URI %q", uri)
+	}
+
+	// Inclusive C14N without comments unless a transform says otherwise.
+	canon := &c14n{}
+	if transforms := ref.child(dsigNS, "Transforms"); transforms != nil {
+		for _, t := range transforms.children(dsigNS, "Transform") {
+			if t.attr("", "Algorithm") == algEnveloped {
+				canon.skip = sig
+				continue
+			}
+			next, err := newC14N(t, uri == "")
+			if err != nil {
+				return &XMLDSigError{Step: XMLDSigStepTransform, Err: err}
+			}
+			next.skip = canon.skip
+			canon = next
+		}
+	}
+
+	digestMethod := ref.child(dsigNS, "DigestMethod")
+	digestValue := ref.child(dsigNS, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return dsigErr(XMLDSigStepDigest, "Reference without DigestMethod or DigestValue")
+	}
+	var hash crypto.Hash
+	switch alg := digestMethod.attr("", "Algorithm"); alg {
+	case algSHA1:
+		hash = crypto.SHA1
+	case algSHA256:
+		hash = crypto.SHA256
+	case algSHA512:
+		hash = crypto.SHA512
+	default:
+		return dsigErr(XMLDSigStepDigest, "unsupported digest method %q", alg)
+	}
+	want, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(digestValue.textContent()), ""))
+	if err != nil {
+		return dsigErr(XMLDSigStepDigest, "bad base64: %v", err)
+	}
+
+	h := hash.New()
+	h.Write(canon.canonicalize(target))
+	if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+		return dsigErr(XMLDSigStepDigest, "digest mismatch for Reference URI %q", uri)
+	}
+	return nil
+}
+
+// newC14N builds a canonicalizer from a CanonicalizationMethod or
+// Transform element. Comments never survive a same-document URI="".
+func newC14N(method *xmlNode, wholeDoc bool) (*c14n, error) {
+	c := &c14n{}
+	switch alg := method.attr("", "Algorithm"); alg {
+	case algC14N, algC14N11:
+	case algC14NComments, algC14N11Comments:
+		c.comments = true
+	case algExcC14N, algExcC14NComments:
+		c.exclusive = true
+		c.comments = alg == algExcC14NComments
+		if inc := method.child(algExcC14N, "InclusiveNamespaces"); inc != nil {
+			c.inclusive = make(map[string]bool)
+			for _, p := range strings.Fields(inc.attr("", "PrefixList")) {
+				if p == "#default" {
+					p = ""
+				}
+				c.inclusive[p] = true
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported canonicalization %q", alg)
+	}
+	if wholeDoc {
+		c.comments = false
+	}
+	return c, nil
+}
+
+type xmlNodeKind int
+
+const (
+	xmlDocumentNode xmlNodeKind = iota
+	xmlElementNode
+	xmlTextNode
+	xmlCommentNode
+	xmlProcInstNode
+)
+
+// xmlNode is a minimal DOM built from raw tokens, keeping namespace
+// prefixes as written so they can be canonicalized.
+type xmlNode struct {
+	kind   xmlNodeKind
+	parent *xmlNode
+	name   xml.Name   // Space holds the prefix
+	attrs  []xml.Attr // Space holds the prefix
+	nodes  []*xmlNode
+	text   string
+}
+
+func parseXMLTree(b []byte) (*xmlNode, error) {
+	doc := &xmlNode{kind: xmlDocumentNode}
+	cur := doc
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{kind: xmlElementNode, parent: cur, name: t.Name, attrs: append([]xml.Attr(nil), t.Attr...)}
+			cur.nodes = append(cur.nodes, n)
+			cur = n
+		case xml.EndElement:
+			if cur.kind != xmlElementNode || cur.name != t.Name {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur.kind == xmlDocumentNode {
+				// whitespace outside the document element
+				continue
+			}
+			cur.nodes = append(cur.nodes, &xmlNode{kind: xmlTextNode, parent: cur, text: string(t)})
+		case xml.Comment:
+			cur.nodes = append(cur.nodes, &xmlNode{kind: xmlCommentNode, parent: cur, text: string(t)})
+		case xml.ProcInst:
+			if t.Target == "xml" {
+				continue
+			}
+			cur.nodes = append(cur.nodes, &xmlNode{kind: xmlProcInstNode, parent: cur,
+				name: xml.Name{Local: t.Target}, text: string(t.Inst)})
+		}
+	}
+	if cur != doc {
+		return nil, errors.New("unclosed element " + cur.name.Local)
+	}
+	return doc, nil
+}
+
+// namespace resolves prefix in the scope of n; "" is the default
+// namespace. ok is false for undeclared prefixes.
+func (n *xmlNode) namespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNS, true
+	}
+	for e := n; e != nil; e = e.parent {
+		for _, a := range e.attrs {
+			if (prefix == "" && a.Name.Space == "" && a.Name.Local == "xmlns") ||
+				(prefix != "" && a.Name.Space == "xmlns" && a.Name.Local == prefix) {
+				return a.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// inScope lists the namespace declarations in effect at n.
+func (n *xmlNode) inScope() map[string]string {
+	ns := make(map[string]string)
+	for e := n; e != nil; e = e.parent {
+		for _, a := range e.attrs {
+			if p, ok := nsDeclPrefix(a); ok {
+				if _, seen := ns[p]; !seen {
+					ns[p] = a.Value
+				}
+			}
+		}
+	}
+	return ns
+}
+
+func nsDeclPrefix(a xml.Attr) (string, bool) {
+	if a.Name.Space == "" && a.Name.Local == "xmlns" {
+		return "", true
+	}
+	if a.Name.Space == "xmlns" {
+		return a.Name.Local, true
+	}
+	return "", false
+}
+
+func (n *xmlNode) is(space, local string) bool {
+	if n.kind != xmlElementNode || n.name.Local != local {
+		return false
+	}
+	uri, _ := n.namespace(n.name.Space)
+	return uri == space
+}
+
+func (n *xmlNode) child(space, local string) *xmlNode {
+	for _, c := range n.nodes {
+		if c.is(space, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *xmlNode) children(space, local string) []*xmlNode {
+	var out []*xmlNode
+	for _, c := range n.nodes {
+		if c.is(space, local) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// attr returns an unprefixed attribute when prefix is "".
+func (n *xmlNode) attr(prefix, local string) string {
+	for _, a := range n.attrs {
+		if a.Name.Space == prefix && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) find(match func(*xmlNode) bool) *xmlNode {
+	if n.kind == xmlElementNode && match(n) {
+		return n
+	}
+	for _, c := range n.nodes {
+		if found := c.find(match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (n *xmlNode) textContent() string {
+	var sb strings.Builder
+	for _, c := range n.nodes {
+		switch c.kind {
+		case xmlTextNode:
+			sb.WriteString(c.text)
+		case xmlElementNode:
+			sb.WriteString(c.textContent())
+		}
+	}
+	return sb.String()
+}
+
+// c14n implements Canonical XML 1.0 and Exclusive XML Canonicalization
+// for a whole document or an element subtree, optionally omitting one
+// subtree (the enveloped signature).
+type c14n struct {
+	exclusive bool
+	comments  bool
+	inclusive map[string]bool // exclusive InclusiveNamespaces PrefixList
+	skip      *xmlNode
+}
+
+func (c *c14n) canonicalize(n *xmlNode) []byte {
+	var buf bytes.Buffer
+	if n.kind != xmlDocumentNode {
+		c.element(&buf, n, map[string]string{}, true)
+		return buf.Bytes()
+	}
+
+	afterRoot := false
+	for _, child := range n.nodes {
+		switch child.kind {
+		case xmlElementNode:
+			c.element(&buf, child, map[string]string{}, true)
+			afterRoot = true
+		case xmlCommentNode, xmlProcInstNode:
+			if child.kind == xmlCommentNode && !c.comments {
+				continue
+			}
+			if afterRoot {
+				buf.WriteByte('\n')
+			}
+			c.node(&buf, child)
+			if !afterRoot {
+				buf.WriteByte('\n')
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func (c *c14n) node(buf *bytes.Buffer, n *xmlNode) {
+	switch n.kind {
+	case xmlTextNode:
+		buf.WriteString(escapeC14NText(n.text))
+	case xmlCommentNode:
+		if c.comments {
+			buf.WriteString("<!--" + n.text + "-->")
+		}
+	case xmlProcInstNode:
+		buf.WriteString("<?" + n.name.Local)
+		if inst := strings.TrimLeft(n.text, " \t\r\n"); inst != "" {
+			buf.WriteString(" " + inst)
+		}
+		buf.WriteString("?>")
+	}
+}
+
+// element writes n. rendered holds the namespace declarations already
+// output by ancestors in the canonical form.
+func (c *c14n) element(buf *bytes.Buffer, n *xmlNode, rendered map[string]string, apex bool) {
+	if n == c.skip {
+		return
+	}
+
+	// Namespace declarations to emit on this element.
+	decls := make(map[string]string)
+	if c.exclusive {
+		used := map[string]bool{n.name.Space: true}
+		for _, a := range n.attrs {
+			if _, isDecl := nsDeclPrefix(a); !isDecl && a.Name.Space != "" && a.Name.Space != "xml" {
+				used[a.Name.Space] = true
+			}
+		}
+		for p := range c.inclusive {
+			used[p] = true
+		}
+		for p := range used {
+			uri, ok := n.namespace(p)
+			if !ok && p != "" {
+				continue
+			}
+			if prev, seen := rendered[p]; (seen && prev == uri) || (!seen && p == "" && uri == "") {
+				continue
+			}
+			decls[p] = uri
+		}
+	} else {
+		for p, uri := range n.inScope() {
+			if prev, seen := rendered[p]; (seen && prev == uri) || (!seen && p == "" && uri == "") {
+				continue
+			}
+			decls[p] = uri
+		}
+	}
+
+	// Regular attributes, plus xml:* inherited from outside the subset
+	// for inclusive canonicalization of an apex element.
+	type c14nAttr struct {
+		uri, qname, local, value string
+	}
+	var attrs []c14nAttr
+	seenXML := make(map[string]bool)
+	for _, a := range n.attrs {
+		if _, isDecl := nsDeclPrefix(a); isDecl {
+			continue
+		}
+		qname, uri := a.Name.Local, ""
+		if a.Name.Space != "" {
+			qname = a.Name.Space + ":" + a.Name.Local
+			uri, _ = n.namespace(a.Name.Space)
+		}
+		if a.Name.Space == "xml" {
+			seenXML[a.Name.Local] = true
+		}
+		attrs = append(attrs, c14nAttr{uri, qname, a.Name.Local, a.Value})
+	}
+	if apex && !c.exclusive {
+		for e := n.parent; e != nil; e = e.parent {
+			for _, a := range e.attrs {
+				if a.Name.Space == "xml" && !seenXML[a.Name.Local] {
+					seenXML[a.Name.Local] = true
+					attrs = append(attrs, c14nAttr{xmlNS, "xml:" + a.Name.Local, a.Name.Local, a.Value})
+				}
+			}
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].uri != attrs[j].uri {
+			return attrs[i].uri < attrs[j].uri
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	qname := n.name.Local
+	if n.name.Space != "" {
+		qname = n.name.Space + ":" + n.name.Local
+	}
+	buf.WriteString("<" + qname)
+
+	prefixes := make([]string, 0, len(decls))
+	for p := range decls {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	childRendered := rendered
+	if len(decls) > 0 {
+		childRendered = make(map[string]string, len(rendered)+len(decls))
+		for p, uri := range rendered {
+			childRendered[p] = uri
+		}
+	}
+	for _, p := range prefixes {
+		if p == "" {
+			buf.WriteString(` xmlns="` + escapeC14NAttr(decls[p]) + `"`)
+		} else {
+			buf.WriteString(" xmlns:" + p + `="` + escapeC14NAttr(decls[p]) + `"`)
+		}
+		childRendered[p] = decls[p]
+	}
+	for _, a := range attrs {
+		buf.WriteString(" " + a.qname + `="` + escapeC14NAttr(a.value) + `"`)
+	}
+	buf.WriteByte('>')
+
+	for _, child := range n.nodes {
+		if child.kind == xmlElementNode {
+			c.element(buf, child, childRendered, false)
+		} else {
+			c.node(buf, child)
+		}
+	}
+	buf.WriteString("</" + qname + ">")
+}
+
+var (
+	c14nTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	c14nAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeC14NText(s string) string { return c14nTextEscaper.Replace(s) }
+func escapeC14NAttr(s string) string { return c14nAttrEscaper.Replace(s) }
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// testdata/xmldsig holds enveloped signatures over the same e-KYC document
+// made with an independent implementation (goxmldsig), one per
+// canonicalization method and Signature prefix, and the signing cert.
+
+func testKey(t *testing.T) *rsa.PublicKey {
+	t.Helper()
+	b, err := os.ReadFile("testdata/xmldsig/cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(b)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.PublicKey.(*rsa.PublicKey)
+}
+
+func signedKYC(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata/xmldsig", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVerifyXMLDSigFixtures(t *testing.T) {
+	pub := testKey(t)
+	files, err := filepath.Glob("testdata/xmldsig/*.xml")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, f := range files {
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			if err := VerifyXMLDSig(signedKYC(t, filepath.Base(f)), pub); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestVerifyXMLDSigRejects(t *testing.T) {
+	pub := testKey(t)
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := signedKYC(t, "kyc_exc_ds.xml")
+	sigValue := regexp.MustCompile(`<ds:SignatureValue>(.)`)
+
+	tests := []struct {
+		name     string
+		doc      []byte
+		pub      *rsa.PublicKey
+		wantStep string
+	}{
+		{"tampered attribute", bytes.Replace(doc, []byte(`name="Ravi Kumar"`), []byte(`name="Ravi Kumat"`), 1), pub, XMLDSigStepDigest},
+		{"tampered text", bytes.Replace(doc, []byte("<Pht>/9j/"), []byte("<Pht>/9k/"), 1), pub, XMLDSigStepDigest},
+		{"tampered signature value", sigValue.ReplaceAll(doc, []byte("<ds:SignatureValue>A")), pub, XMLDSigStepSignatureValue},
+		{"unsupported digest", bytes.Replace(doc, []byte("xmlenc#sha256"), []byte("xmlenc#sha384"), 1), pub, XMLDSigStepDigest},
+		{"unsupported transform", bytes.Replace(doc, []byte(`Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"`), []byte(`Transform Algorithm="urn:unknown"`), 1), pub, XMLDSigStepTransform},
+		{"dangling reference", bytes.Replace(doc, []byte(`URI=""`), []byte(`URI="#missing"`), 1), pub, XMLDSigStepReference},
+		{"wrong key", doc, &other.PublicKey, XMLDSigStepSignatureValue},
+		{"no key", doc, nil, XMLDSigStepKey},
+		{"not XML", []byte("<OfflinePaperlessKyc>"), pub, XMLDSigStepParse},
+		{"unsigned", []byte(`<OfflinePaperlessKyc referenceId="1"/>`), pub, XMLDSigStepSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyXMLDSig(tt.doc, tt.pub)
+			var dsigErr *XMLDSigError
+			if !errors.As(err, &dsigErr) {
+				t.Fatalf("err = %v, want XMLDSigError", err)
+			}
+			if dsigErr.Step != tt.wantStep {
+				t.Errorf("step = %q (%v), want %q", dsigErr.Step, err, tt.wantStep)
+			}
+			if got := errors.Is(err, ErrNoXMLSignature); got != (tt.name == "unsigned") {
+				t.Errorf("errors.Is(err, ErrNoXMLSignature) = %v", got)
+			}
+		})
+	}
+}
+
+// The canonicalization vectors are the examples of the Canonical XML 1.0
+// and Exclusive XML Canonicalization recommendations, minus the parts
+// that need DTD processing (default attributes, attribute types).
+func TestC14N(t *testing.T) {
+	const nsDoc = `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"/></n1:elem2></n0:local>`
+
+	tests := []struct {
+		name string
+		c    c14n
+		in   string
+		elem string // canonicalize this element instead of the document
+		want string
+	}{
+		{
+			name: "PIs, comments and outside of document element",
+			in: `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`,
+			want: `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!</doc>
+<?pi-without-data?>`,
+		},
+		{
+			name: "PIs, comments and outside of document element, with comments",
+			c:    c14n{comments: true},
+			in: `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`,
+			want: `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!<!-- Comment 1 --></doc>
+<?pi-without-data?>
+<!-- Comment 2 -->
+<!-- Comment 3 -->`,
+		},
+		{
+			name: "start and end tags",
+			in: `<doc>
+   <e1   />
+   <e2   ></e2>
+   <e3   name = "elem3"   id="elem3"   />
+   <e4   name="elem4"   id="elem4"   ></e4>
+   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"
+      xmlns:b="http://www.ietf.org"
+      xmlns:a="http://www.w3.org"
+      xmlns="http://example.org"/>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+			want: `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6 xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 xmlns:a="http://www.ietf.org"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+		},
+		{
+			name: "character modifications",
+			in: `<doc>
+   <text>First line&#x0d;&#10;Second line</text>
+   <value>&#x32;</value>
+   <compute><![CDATA[value>"0" && value<"10" ?"valid":"error"]]></compute>
+   <compute expr='value>"0" &amp;&amp; value&lt;"10" ?"valid":"error"'>valid</compute>
+   <norm attr=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+</doc>`,
+			want: `<doc>
+   <text>First line&#xD;
+Second line</text>
+   <value>2</value>
+   <compute>value&gt;"0" &amp;&amp; value&lt;"10" ?"valid":"error"</compute>
+   <compute expr="value>&quot;0&quot; &amp;&amp; value&lt;&quot;10&quot; ?&quot;valid&quot;:&quot;error&quot;">valid</compute>
+   <norm attr=" '    &#xD;&#xA;&#x9;   ' "></norm>
+</doc>`,
+		},
+		{
+			name: "inclusive subtree",
+			in:   nsDoc,
+			elem: "elem2",
+			want: `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en"><n3:stuff></n3:stuff></n1:elem2>`,
+		},
+		{
+			name: "exclusive subtree",
+			c:    c14n{exclusive: true},
+			in:   nsDoc,
+			elem: "elem2",
+			want: `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"></n3:stuff></n1:elem2>`,
+		},
+		{
+			name: "exclusive subtree with InclusiveNamespaces",
+			c:    c14n{exclusive: true, inclusive: map[string]bool{"n0": true}},
+			in:   nsDoc,
+			elem: "elem2",
+			want: `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"></n3:stuff></n1:elem2>`,
+		},
+		{
+			name: "inclusive subtree inherits xml attributes",
+			in:   `<a xml:lang="en" xml:space="preserve"><b xml:lang="fr"/></a>`,
+			elem: "b",
+			want: `<b xml:lang="fr" xml:space="preserve"></b>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := parseXMLTree([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.elem != "" {
+				n = n.find(func(e *xmlNode) bool { return e.name.Local == tt.elem })
+			}
+			if got := string(tt.c.canonicalize(n)); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ErrZipPassword is returned when an encrypted ZIP entry does not open
+// with the given password (for offline e-KYC files, the share code).
+var ErrZipPassword = errors.New("incorrect ZIP password")
+
+const (
+	zipMethodAES      = 99
+	zipExtraAES       = 0x9901
+	zipAESAuthCodeLen = 10
+	zipCryptoHeader   = 12
+
+	// maxZipEntrySize is far above any offline e-KYC XML, photo included.
+	maxZipEntrySize = 64 << 20
+)
+
+// readZipEntry returns the uncompressed contents of f, decrypting it with
+// password when the entry is encrypted. archive/zip does not support
+// encryption, so the raw entry data is decrypted here: traditional PKWARE
+// ZipCrypto, and WinZip AES (AE-1/AE-2, 128-256 bit).
+func readZipEntry(f *zip.File, password []byte) ([]byte, error) {
+	if f.UncompressedSize64 > maxZipEntrySize {
+		return nil, fmt.Errorf("ZIP entry too large (%d bytes)", f.UncompressedSize64)
+	}
+	encrypted := f.Flags&0x1 != 0
+	if !encrypted {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	method, checkCRC := f.Method, true
+	if f.Method == zipMethodAES {
+		var ae2 bool
+		if data, method, ae2, err = zipAESDecrypt(f, data, password); err != nil {
+			return nil, err
+		}
+		// AE-2 stores no CRC; the HMAC already authenticated the data.
+		checkCRC = !ae2
+	} else {
+		if data, err = zipCryptoDecrypt(f, data, password); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []byte
+	switch method {
+	case zip.Store:
+		out = data
+	case zip.Deflate:
+		// archive/zip stops plain entries at their declared size; do the
+		// same so a small upload cannot inflate without bound.
+		fr := flate.NewReader(bytes.NewReader(data))
+		defer fr.Close()
+		if out, err = io.ReadAll(io.LimitReader(fr, int64(f.UncompressedSize64)+1)); err != nil {
+			// Garbage from a ZipCrypto false positive on the
+			// one-byte password check usually fails here.
+			return nil, fmt.Errorf("%w (inflate: %v)", ErrZipPassword, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ZIP compression method %d", method)
+	}
+
+	if uint64(len(out)) != f.UncompressedSize64 {
+		// Like a CRC mismatch, with ZipCrypto this is usually a wrong
+		// password; AES entries are authenticated, so it is a bad file.
+		if f.Method != zipMethodAES {
+			return nil, fmt.Errorf("%w (size mismatch)", ErrZipPassword)
+		}
+		return nil, fmt.Errorf("ZIP entry is %d bytes, header says %d", len(out), f.UncompressedSize64)
+	}
+	if checkCRC && crc32.ChecksumIEEE(out) != f.CRC32 {
+		return nil, fmt.Errorf("%w (CRC mismatch)", ErrZipPassword)
+	}
+	return out, nil
+}
+
+// zipCryptoDecrypt implements the traditional PKWARE stream cipher.
+func zipCryptoDecrypt(f *zip.File, data, password []byte) ([]byte, error) {
+	if len(data) < zipCryptoHeader {
+		return nil, fmt.Errorf("ZipCrypto entry too short")
+	}
+
+	keys := [3]uint32{0x12345678, 0x23456789, 0x34567890}
+	update := func(c byte) {
+		keys[0] = crc32Update(keys[0], c)
+		keys[1] = (keys[1]+keys[0]&0xFF)*134775813 + 1
+		keys[2] = crc32Update(keys[2], byte(keys[1]>>24))
+	}
+	for _, c := range password {
+		update(c)
+	}
+
+	out := make([]byte, len(data))
+	for i, c := range data {
+		t := keys[2] | 2
+		p := c ^ byte((t*(t^1))>>8)
+		update(p)
+		out[i] = p
+	}
+
+	// The last header byte is the high byte of the CRC, or of the DOS
+	// modification time when sizes live in a data descriptor.
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if out[zipCryptoHeader-1] != check {
+		return nil, ErrZipPassword
+	}
+	return out[zipCryptoHeader:], nil
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+// zipAESDecrypt implements the WinZip AES format: PBKDF2-HMAC-SHA1 key
+// derivation, AES-CTR with a little-endian counter and a truncated
+// HMAC-SHA1 authentication code.
+func zipAESDecrypt(f *zip.File, data, password []byte) ([]byte, uint16, bool, error) {
+	extra := f.Extra
+	var field []byte
+	for len(extra) >= 4 {
+		id, size := binary.LittleEndian.Uint16(extra), int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			break
+		}
+		if id == zipExtraAES {
+			field = extra[4 : 4+size]
+			break
+		}
+		extra = extra[4+size:]
+	}
+	if len(field) < 7 {
+		return nil, 0, false, fmt.Errorf("AES entry without AES extra field")
+	}
+	ae2 := binary.LittleEndian.Uint16(field) == 2
+	method := binary.LittleEndian.Uint16(field[5:])
+
+	var keyLen int
+	switch field[4] {
+	case 1:
+		keyLen = 16
+	case 2:
+		keyLen = 24
+	case 3:
+		keyLen = 32
+	default:
+		return nil, 0, false, fmt.Errorf("unknown AES strength %d", field[4])
+	}
+	saltLen := keyLen / 2
+	if len(data) < saltLen+2+zipAESAuthCodeLen {
+		return nil, 0, false, fmt.Errorf("AES entry too short")
+	}
+	salt := data[:saltLen]
+	verifier := data[saltLen : saltLen+2]
+	body := data[saltLen+2 : len(data)-zipAESAuthCodeLen]
+	authCode := data[len(data)-zipAESAuthCodeLen:]
+
+	keys, err := pbkdf2.Key(sha1.New, string(password), salt, 1000, 2*keyLen+2)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	encKey, macKey := keys[:keyLen], keys[keyLen:2*keyLen]
+	if !bytes.Equal(keys[2*keyLen:], verifier) {
+		return nil, 0, false, ErrZipPassword
+	}
+
+	mac := hmac.New(sha1.New, macKey)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil)[:zipAESAuthCodeLen], authCode) {
+		return nil, 0, false, fmt.Errorf("%w (authentication code mismatch)", ErrZipPassword)
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	out := make([]byte, len(body))
+	var counter, stream [aes.BlockSize]byte
+	for i := 0; i < len(body); i += aes.BlockSize {
+		// 128-bit little-endian counter starting at 1
+		for j := range counter {
+			counter[j]++
+			if counter[j] != 0 {
+				break
+			}
+		}
+		block.Encrypt(stream[:], counter[:])
+		end := min(i+aes.BlockSize, len(body))
+		for j := i; j < end; j++ {
+			out[j] = body[j] ^ stream[j-i]
+		}
+	}
+	return out, method, ae2, nil
+}
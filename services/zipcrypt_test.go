@@ -0,0 +1,218 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zipCryptoEncrypt is the encrypting side of zipCryptoDecrypt.
+func zipCryptoEncrypt(data, password []byte, check byte) []byte {
+	keys := [3]uint32{0x12345678, 0x23456789, 0x34567890}
+	update := func(c byte) {
+		keys[0] = crc32Update(keys[0], c)
+		keys[1] = (keys[1]+keys[0]&0xFF)*134775813 + 1
+		keys[2] = crc32Update(keys[2], byte(keys[1]>>24))
+	}
+	for _, c := range password {
+		update(c)
+	}
+	header := []byte("0123456789a")
+	plain := append(append(header, check), data...)
+	out := make([]byte, len(plain))
+	for i, p := range plain {
+		t := keys[2] | 2
+		out[i] = p ^ byte((t*(t^1))>>8)
+		update(p)
+	}
+	return out
+}
+
+// zipAESEncrypt is the encrypting side of zipAESDecrypt.
+func zipAESEncrypt(t *testing.T, data, password []byte, keyLen int) []byte {
+	salt := bytes.Repeat([]byte{0x5A}, keyLen/2)
+	keys, err := pbkdf2.Key(sha1.New, string(password), salt, 1000, 2*keyLen+2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, len(data))
+	var counter, stream [aes.BlockSize]byte
+	for i := 0; i < len(data); i += aes.BlockSize {
+		for j := range counter {
+			counter[j]++
+			if counter[j] != 0 {
+				break
+			}
+		}
+		block.Encrypt(stream[:], counter[:])
+		for j := i; j < min(i+aes.BlockSize, len(data)); j++ {
+			body[j] = data[j] ^ stream[j-i]
+		}
+	}
+	mac := hmac.New(sha1.New, keys[keyLen:2*keyLen])
+	mac.Write(body)
+
+	out := append(append([]byte(nil), salt...), keys[2*keyLen:]...)
+	out = append(out, body...)
+	return append(out, mac.Sum(nil)[:zipAESAuthCodeLen]...)
+}
+
+func zipAESExtra(version uint16, keyLen int, method uint16) []byte {
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra, zipExtraAES)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], version)
+	copy(extra[6:], "AE")
+	extra[8] = byte(keyLen/8 - 1)
+	binary.LittleEndian.PutUint16(extra[9:], method)
+	return extra
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	fw, _ := flate.NewWriter(&b, flate.BestCompression)
+	fw.Write(data)
+	fw.Close()
+	return b.Bytes()
+}
+
+// rawZipEntry writes raw, already compressed and encrypted, data under hdr
+// and reads the entry back.
+func rawZipEntry(t *testing.T, hdr *zip.FileHeader, raw []byte) *zip.File {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.CreateRaw(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(raw)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr.File[0]
+}
+
+func TestReadZipEntry(t *testing.T) {
+	xml := []byte(strings.Repeat(`<OfflinePaperlessKyc referenceId="123420240101120000123"/>`, 20))
+	crc := crc32.ChecksumIEEE(xml)
+	bomb := make([]byte, 1<<20)
+	password := []byte("1234")
+
+	zipCrypto := func(method uint16, data []byte, crc uint32, size uint64) func(t *testing.T, pw []byte) *zip.File {
+		return func(t *testing.T, pw []byte) *zip.File {
+			raw := zipCryptoEncrypt(data, pw, byte(crc>>24))
+			return rawZipEntry(t, &zip.FileHeader{Name: "kyc.xml", Method: method, Flags: 0x1,
+				CRC32: crc, CompressedSize64: uint64(len(raw)), UncompressedSize64: size}, raw)
+		}
+	}
+	winZipAES := func(version uint16, keyLen int, method uint16, data []byte, crc uint32, size uint64) func(t *testing.T, pw []byte) *zip.File {
+		return func(t *testing.T, pw []byte) *zip.File {
+			raw := zipAESEncrypt(t, data, pw, keyLen)
+			return rawZipEntry(t, &zip.FileHeader{Name: "kyc.xml", Method: zipMethodAES, Flags: 0x1, Extra: zipAESExtra(version, keyLen, method),
+				CRC32: crc, CompressedSize64: uint64(len(raw)), UncompressedSize64: size}, raw)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		entry    func(t *testing.T, pw []byte) *zip.File
+		open     []byte
+		want     []byte
+		wantErr  string
+		password bool
+	}{
+		{name: "ZipCrypto stored", entry: zipCrypto(zip.Store, xml, crc, uint64(len(xml))), open: password, want: xml},
+		{name: "ZipCrypto deflated", entry: zipCrypto(zip.Deflate, deflate(xml), crc, uint64(len(xml))), open: password, want: xml},
+		{name: "ZipCrypto wrong password", entry: zipCrypto(zip.Deflate, deflate(xml), crc, uint64(len(xml))), open: []byte("4321"), password: true},
+		{name: "ZipCrypto CRC mismatch", entry: zipCrypto(zip.Store, xml, crc^1, uint64(len(xml))), open: password, password: true},
+		{name: "ZipCrypto inflates past header size", entry: zipCrypto(zip.Deflate, deflate(bomb), crc32.ChecksumIEEE(bomb), 100), open: password, password: true},
+		{name: "AES-128 AE-2 stored", entry: winZipAES(2, 16, zip.Store, xml, 0, uint64(len(xml))), open: password, want: xml},
+		{name: "AES-192 AE-1 deflated", entry: winZipAES(1, 24, zip.Deflate, deflate(xml), crc, uint64(len(xml))), open: password, want: xml},
+		{name: "AES-256 AE-2 deflated", entry: winZipAES(2, 32, zip.Deflate, deflate(xml), 0, uint64(len(xml))), open: password, want: xml},
+		{name: "AES-256 wrong password", entry: winZipAES(2, 32, zip.Deflate, deflate(xml), 0, uint64(len(xml))), open: []byte("0000"), password: true},
+		{name: "AES-256 AE-1 CRC mismatch", entry: winZipAES(1, 32, zip.Store, xml, crc^1, uint64(len(xml))), open: password, password: true},
+		{name: "AES inflates past header size", entry: winZipAES(2, 32, zip.Deflate, deflate(bomb), 0, 100), open: password, wantErr: "header says 100"},
+		{name: "declared size too large", entry: zipCrypto(zip.Deflate, deflate(xml), crc, maxZipEntrySize+1), open: password, wantErr: "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.entry(t, password)
+			got, err := readZipEntry(f, tt.open)
+			switch {
+			case tt.password:
+				if !errors.Is(err, ErrZipPassword) {
+					t.Fatalf("err = %v, want ErrZipPassword", err)
+				}
+			case tt.wantErr != "":
+				if err == nil || errors.Is(err, ErrZipPassword) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !bytes.Equal(got, tt.want):
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testdata/zipcrypt holds the same kyc.xml encrypted with share code
+// "1234" by other tools: Info-ZIP zip -P, from a file and from stdin, and
+// bsdtar with ZipCrypto, AES-128 and AES-256. All of them write a data
+// descriptor, so the ZipCrypto check byte comes from the modification time.
+func TestReadZipEntryArchives(t *testing.T) {
+	want := []byte(`<OfflinePaperlessKyc referenceId="123420240101120000123"><UidData><Poi name="Ravi Kumar"/></UidData></OfflinePaperlessKyc>` + "\n")
+	for _, name := range []string{"infozip.zip", "infozip-stream.zip", "bsdtar-zipcrypto.zip", "bsdtar-aes128.zip", "bsdtar-aes256.zip"} {
+		t.Run(name, func(t *testing.T) {
+			zr, err := zip.OpenReader(filepath.Join("testdata/zipcrypt", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zr.Close()
+			f := zr.File[0]
+			got, err := readZipEntry(f, []byte("1234"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %q", got)
+			}
+			if _, err := readZipEntry(f, []byte("4321")); !errors.Is(err, ErrZipPassword) {
+				t.Errorf("wrong share code: err = %v, want ErrZipPassword", err)
+			}
+		})
+	}
+}
+
+// TestCRC32Update checks the ZipCrypto key step is the byte step of the
+// IEEE CRC-32, without the initial and final inversion.
+func TestCRC32Update(t *testing.T) {
+	for _, in := range []string{"", "a", "1234", "123456789"} {
+		crc := ^uint32(0)
+		for _, b := range []byte(in) {
+			crc = crc32Update(crc, b)
+		}
+		if got, want := ^crc, crc32.ChecksumIEEE([]byte(in)); got != want {
+			t.Errorf("CRC of %q = %#x, want %#x", in, got, want)
+		}
+	}
+}
@@ -36,4 +36,4 @@ Write-Host "CGO_LDFLAGS: $env:CGO_LDFLAGS"
 Write-Host "PATH updated."
 
 Write-Host "Run this next:"
-Write-Host "go build -v -x -o aadhaar-qr-service.exe"
+Write-Host "go build -v -x -tags `"quirc zbar`" -o aadhaar-qr-service.exe"
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"sync"
+)
+
+// DecodeEach runs the DecodeSearch chain separately for every enabled
+// decoder, concurrently, so their payloads can be compared. It returns
+// the successful results in try order and why each other decoder failed.
+// The error is only set when ctx ends the run.
+func (r *DecoderRegistry) DecodeEach(ctx context.Context, img image.Image, pre []Preprocessor, opts SearchOptions) ([]*DecodeResult, map[string]error, error) {
+	decoders := r.Decoders()
+	if len(decoders) == 0 {
+		return nil, nil, fmt.Errorf("no QR decoders enabled")
+	}
+
+	results := make([]*DecodeResult, len(decoders))
+	errs := make([]error, len(decoders))
+	var wg sync.WaitGroup
+	for i, d := range decoders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			single := NewDecoderRegistry(d.Name())
+			single.Register(d)
+			results[i], errs[i] = single.DecodeSearchContext(ctx, img, pre, opts)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, nil, context.Cause(ctx)
+	}
+
+	var found []*DecodeResult
+	failed := make(map[string]error)
+	for i, d := range decoders {
+		if errs[i] != nil {
+			failed[d.Name()] = errs[i]
+			continue
+		}
+		found = append(found, results[i])
+	}
+	log.Printf("[consensus] %d of %d decoders produced a payload\n", len(found), len(decoders))
+	return found, failed, nil
+}
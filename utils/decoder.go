@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Decoder turns an image into the raw bytes stored in a QR code.
+// Implementations register themselves with a DecoderRegistry so the
+// handler never needs to know which backends exist.
+type Decoder interface {
+	Name() string
+	Decode(img image.Image) (*DecodeResult, error)
+}
+
+// ContextDecoder is implemented by decoders that can give up when ctx is
+// done. The registry falls back to Decode for decoders without it.
+type ContextDecoder interface {
+	Decoder
+	DecodeContext(ctx context.Context, img image.Image) (*DecodeResult, error)
+}
+
+// ErrDecoderUnavailable is returned by native decoders that were not
+// compiled into this binary (see the quirc and zbar build tags).
+var ErrDecoderUnavailable = errors.New("decoder not compiled into this build")
+
+// DecodeResult is the payload produced by a Decoder plus whatever the
+// backend knows about how it got there.
+type DecodeResult struct {
+	Payload   []byte            `json:"-"`
+	Decoder   string            `json:"decoder"`
+	Variant   string            `json:"variant,omitempty"`
+	Transform string            `json:"transform,omitempty"`
+	Page      int               `json:"page,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+
+	// Set by DecodeRace: the mode and how many attempts had finished
+	// when the winner was picked.
+	Mode     string `json:"mode,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+
+	// Polygon outlines the code in the decoded image, set by DecodeAll
+	// for backends that report where each code was found.
+	Polygon []Point `json:"polygon,omitempty"`
+}
+
+// DefaultDecoderOrder is the order the built-in decoders are tried in
+// when no explicit order has been configured.
+var DefaultDecoderOrder = []string{"quirc", "zbar", "zxing"}
+
+// DecoderRegistry holds the known decoders, the order they are tried in
+// and which of them are currently disabled.
+type DecoderRegistry struct {
+	mu       sync.RWMutex
+	decoders map[string]Decoder
+	order    []string
+	disabled map[string]bool
+}
+
+func NewDecoderRegistry(order ...string) *DecoderRegistry {
+	return &DecoderRegistry{
+		decoders: make(map[string]Decoder),
+		order:    append([]string(nil), order...),
+		disabled: make(map[string]bool),
+	}
+}
+
+// DefaultDecoders is the registry built-in decoders add themselves to.
+var DefaultDecoders = NewDecoderRegistry(DefaultDecoderOrder...)
+
+// RegisterDecoder adds d to DefaultDecoders.
+func RegisterDecoder(d Decoder) {
+	DefaultDecoders.Register(d)
+}
+
+// Register adds d to the registry, replacing any decoder with the same
+// name. Decoders not already named in the order are appended to it.
+func (r *DecoderRegistry) Register(d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := d.Name()
+	r.decoders[name] = d
+	for _, n := range r.order {
+		if n == name {
+			return
+		}
+	}
+	r.order = append(r.order, name)
+}
+
+// SetOrder moves the named decoders to the front in the given order.
+// Decoders that are not mentioned keep their relative order after them.
+func (r *DecoderRegistry) SetOrder(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]bool, len(names))
+	order := make([]string, 0, len(r.order)+len(names))
+	for _, n := range names {
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		order = append(order, n)
+	}
+	for _, n := range r.order {
+		if !seen[n] {
+			order = append(order, n)
+		}
+	}
+	r.order = order
+}
+
+func (r *DecoderRegistry) Enable(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.disabled, name)
+}
+
+func (r *DecoderRegistry) Disable(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disabled[name] = true
+}
+
+// Configure applies a comma separated decoder spec such as
+// "zxing,quirc,-zbar": listed names are enabled and tried in that order,
+// names prefixed with '-' are disabled.
+func (r *DecoderRegistry) Configure(spec string) {
+	var order []string
+	for _, field := range strings.Split(spec, ",") {
+		name := strings.TrimSpace(field)
+		if name == "" {
+			continue
+		}
+		if strings.HasPrefix(name, "-") {
+			r.Disable(strings.TrimPrefix(name, "-"))
+			continue
+		}
+		r.Enable(name)
+		order = append(order, name)
+	}
+	r.SetOrder(order...)
+}
+
+// Decoders returns the registered, enabled decoders in try order.
+func (r *DecoderRegistry) Decoders() []Decoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]Decoder, 0, len(r.decoders))
+	for _, name := range r.order {
+		d, ok := r.decoders[name]
+		if !ok || r.disabled[name] {
+			continue
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// Names lists the registered, enabled decoders in try order.
+func (r *DecoderRegistry) Names() []string {
+	decoders := r.Decoders()
+	names := make([]string, len(decoders))
+	for i, d := range decoders {
+		names[i] = d.Name()
+	}
+	return names
+}
+
+// Decode runs img through every enabled decoder in order and returns the
+// first non-empty payload.
+func (r *DecoderRegistry) Decode(img image.Image) (*DecodeResult, error) {
+	return r.DecodeContext(context.Background(), img)
+}
+
+// DecodeContext is Decode, stopping with context.Cause(ctx) once ctx is
+// done.
+func (r *DecoderRegistry) DecodeContext(ctx context.Context, img image.Image) (*DecodeResult, error) {
+	decoders := r.Decoders()
+	if len(decoders) == 0 {
+		return nil, fmt.Errorf("no QR decoders enabled")
+	}
+
+	var errs []string
+	for _, d := range decoders {
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		log.Printf("[decoders] Attempting %s decode...\n", d.Name())
+		res, err := decodeWith(ctx, d, img)
+		if err == nil && res != nil && len(res.Payload) > 0 {
+			if res.Decoder == "" {
+				res.Decoder = d.Name()
+			}
+			log.Printf("[decoders] %s SUCCESS: decoded %d bytes\n", d.Name(), len(res.Payload))
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		if err == nil {
+			err = fmt.Errorf("empty payload")
+		}
+		log.Printf("[decoders] %s FAILED: %v\n", d.Name(), err)
+		errs = append(errs, fmt.Sprintf("%s: %v", d.Name(), err))
+	}
+
+	return nil, fmt.Errorf("all decoders failed (%s)", strings.Join(errs, "; "))
+}
+
+// decodeWith runs d on img, through DecodeContext when d supports it.
+func decodeWith(ctx context.Context, d Decoder, img image.Image) (*DecodeResult, error) {
+	if cd, ok := d.(ContextDecoder); ok {
+		return cd.DecodeContext(ctx, img)
+	}
+	return d.Decode(img)
+}
+
+// decoderFunc adapts the plain DecodeWithX helpers to the Decoder
+// interface.
+type decoderFunc struct {
+	name string
+	fn   func(image.Image) ([]byte, error)
+}
+
+func (d decoderFunc) Name() string { return d.name }
+
+func (d decoderFunc) Decode(img image.Image) (*DecodeResult, error) {
+	payload, err := d.fn(img)
+	if err != nil {
+		return nil, err
+	}
+	return &DecodeResult{Payload: payload, Decoder: d.name}, nil
+}
+
+// DecodeContext runs Decode in its own goroutine and returns as soon as
+// ctx is done. The native decoders cannot be interrupted, so an abandoned
+// call still finishes in the background, but the caller is freed; no call
+// is started once ctx is done, so the callers' loops over variants and
+// search steps stop there.
+func (d decoderFunc) DecodeContext(ctx context.Context, img image.Image) (*DecodeResult, error) {
+	if ctx.Done() == nil {
+		return d.Decode(img)
+	}
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	type result struct {
+		res *DecodeResult
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := d.Decode(img)
+		done <- result{res, err}
+	}()
+	select {
+	case r := <-done:
+		return r.res, r.err
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// NewDecoderFunc wraps a decode function as a named Decoder.
+func NewDecoderFunc(name string, fn func(image.Image) ([]byte, error)) Decoder {
+	return decoderFunc{name: name, fn: fn}
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+)
+
+// EXIF orientation values (TIFF tag 0x0112): how the stored pixels must be
+// transformed for the image to display upright.
+const (
+	OrientationNormal      = 1
+	OrientationMirrorH     = 2
+	OrientationRotate180   = 3
+	OrientationMirrorV     = 4
+	OrientationTranspose   = 5
+	OrientationRotate90CW  = 6
+	OrientationTransverse  = 7
+	OrientationRotate270CW = 8
+)
+
+const (
+	exifTagMake             = 0x010F
+	exifTagModel            = 0x0110
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+)
+
+// ErrNoEXIF is returned by ParseEXIF for JPEGs without an Exif APP1 segment.
+var ErrNoEXIF = errors.New("no EXIF data")
+
+// ExifInfo is the subset of EXIF metadata the pipeline cares about.
+// Orientation is 1 (normal) when the tag is absent.
+type ExifInfo struct {
+	Orientation int    `json:"orientation"`
+	Make        string `json:"make,omitempty"`
+	Model       string `json:"model,omitempty"`
+	DateTime    string `json:"date_time,omitempty"`
+}
+
+// ParseEXIF reads the Exif APP1 segment of a JPEG file. Only the segment
+// headers before the image data are scanned.
+func ParseEXIF(b []byte) (*ExifInfo, error) {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil, fmt.Errorf("not a JPEG file")
+	}
+
+	pos := 2
+	for pos+4 <= len(b) {
+		if b[pos] != 0xFF {
+			return nil, fmt.Errorf("EXIF: bad marker at offset %d", pos)
+		}
+		marker := b[pos+1]
+		if marker == 0xFF {
+			// fill byte
+			pos++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// start of scan / end of image: no more metadata
+			break
+		}
+		size := int(binary.BigEndian.Uint16(b[pos+2:]))
+		if size < 2 || pos+2+size > len(b) {
+			return nil, fmt.Errorf("EXIF: truncated segment 0x%02X", marker)
+		}
+		seg := b[pos+4 : pos+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return parseTIFF(seg[6:])
+		}
+		pos += 2 + size
+	}
+	return nil, ErrNoEXIF
+}
+
+// parseTIFF reads IFD0 and the Exif sub-IFD of a TIFF structure.
+func parseTIFF(t []byte) (*ExifInfo, error) {
+	if len(t) < 8 {
+		return nil, fmt.Errorf("EXIF: TIFF header too short")
+	}
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("EXIF: bad byte order %q", t[:2])
+	}
+	if order.Uint16(t[2:]) != 42 {
+		return nil, fmt.Errorf("EXIF: bad TIFF magic")
+	}
+
+	info := &ExifInfo{Orientation: OrientationNormal}
+	exifIFD := uint32(0)
+	err := walkIFD(t, order, order.Uint32(t[4:]), func(tag, typ uint16, count uint32, value []byte) {
+		switch tag {
+		case exifTagOrientation:
+			if typ == 3 && count >= 1 {
+				if o := int(order.Uint16(value)); o >= 1 && o <= 8 {
+					info.Orientation = o
+				}
+			}
+		case exifTagMake:
+			info.Make = exifString(typ, value)
+		case exifTagModel:
+			info.Model = exifString(typ, value)
+		case exifTagDateTime:
+			info.DateTime = exifString(typ, value)
+		case exifTagExifIFD:
+			if typ == 4 && count >= 1 {
+				exifIFD = order.Uint32(value)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if exifIFD != 0 {
+		// The capture time is better than IFD0's file modification time;
+		// a broken sub-IFD is not worth failing over.
+		_ = walkIFD(t, order, exifIFD, func(tag, typ uint16, count uint32, value []byte) {
+			if tag == exifTagDateTimeOriginal {
+				if s := exifString(typ, value); s != "" {
+					info.DateTime = s
+				}
+			}
+		})
+	}
+	return info, nil
+}
+
+// walkIFD calls fn for each entry of the IFD at off with the entry's value
+// bytes, resolving values stored out of line.
+func walkIFD(t []byte, order binary.ByteOrder, off uint32, fn func(tag, typ uint16, count uint32, value []byte)) error {
+	if uint64(off)+2 > uint64(len(t)) {
+		return fmt.Errorf("EXIF: IFD offset %d out of range", off)
+	}
+	n := int(order.Uint16(t[off:]))
+	entries := int(off) + 2
+	if entries+n*12 > len(t) {
+		return fmt.Errorf("EXIF: IFD with %d entries is truncated", n)
+	}
+
+	for i := 0; i < n; i++ {
+		e := t[entries+i*12:]
+		tag, typ, count := order.Uint16(e), order.Uint16(e[2:]), order.Uint32(e[4:])
+		size := uint64(exifTypeSize(typ)) * uint64(count)
+		if size == 0 {
+			continue
+		}
+		value := e[8:12]
+		if size > 4 {
+			voff := uint64(order.Uint32(e[8:]))
+			if voff+size > uint64(len(t)) {
+				continue
+			}
+			value = t[voff : voff+size]
+		}
+		fn(tag, typ, count, value)
+	}
+	return nil
+}
+
+// exifTypeSize is the byte size of one value of a TIFF field type.
+func exifTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+func exifString(typ uint16, value []byte) string {
+	if typ != 2 {
+		return ""
+	}
+	if i := bytes.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(string(value))
+}
+
+// ApplyOrientation transforms img so it displays upright for the given EXIF
+// orientation. Orientation 1 and unknown values return img unchanged.
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= OrientationNormal || orientation > OrientationRotate270CW {
+		return img
+	}
+
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if orientation >= OrientationTranspose {
+		dw, dh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case OrientationMirrorH:
+				dx, dy = w-1-x, y
+			case OrientationRotate180:
+				dx, dy = w-1-x, h-1-y
+			case OrientationMirrorV:
+				dx, dy = x, h-1-y
+			case OrientationTranspose:
+				dx, dy = y, x
+			case OrientationRotate90CW:
+				dx, dy = h-1-y, x
+			case OrientationTransverse:
+				dx, dy = h-1-y, w-1-x
+			case OrientationRotate270CW:
+				dx, dy = y, w-1-x
+			}
+			si := y*src.Stride + x*4
+			di := dy*out.Stride + dx*4
+			copy(out.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return out
+}
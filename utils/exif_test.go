@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// tiffOrder is binary.LittleEndian or binary.BigEndian.
+type tiffOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+func shortEntry(order tiffOrder, tag, v uint16) ifdEntry {
+	return ifdEntry{tag, 3, 1, order.AppendUint16(nil, v)}
+}
+
+func asciiEntry(tag uint16, s string) ifdEntry {
+	return ifdEntry{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+// buildTIFF lays out a TIFF header and IFDs, each followed by the values
+// that do not fit in their entry. An entry of type LONG with a nil value
+// in IFD i points at IFD i+1.
+func buildTIFF(order tiffOrder, ifds ...[]ifdEntry) []byte {
+	var b []byte
+	if order == tiffOrder(binary.LittleEndian) {
+		b = append(b, "II"...)
+	} else {
+		b = append(b, "MM"...)
+	}
+	b = order.AppendUint16(b, 42)
+	b = order.AppendUint32(b, 8)
+
+	for i, entries := range ifds {
+		start := len(b)
+		size := 2 + 12*len(entries) + 4
+		b = order.AppendUint16(b, uint16(len(entries)))
+		var extra []byte
+		for _, e := range entries {
+			b = order.AppendUint16(b, e.tag)
+			b = order.AppendUint16(b, e.typ)
+			b = order.AppendUint32(b, e.count)
+			switch {
+			case e.value == nil:
+				b = order.AppendUint32(b, 0) // patched below
+			case len(e.value) <= 4:
+				b = append(b, append(e.value, make([]byte, 4-len(e.value))...)...)
+			default:
+				b = order.AppendUint32(b, uint32(start+size+len(extra)))
+				extra = append(extra, e.value...)
+			}
+		}
+		b = order.AppendUint32(b, 0)
+		b = append(b, extra...)
+		next := uint32(len(b))
+		for j, e := range entries {
+			if e.value == nil && i+1 < len(ifds) {
+				order.PutUint32(b[start+2+12*j+8:], next)
+			}
+		}
+	}
+	return b
+}
+
+// exifJPEG wraps a TIFF structure in a JPEG APP1 segment after an APP0.
+func exifJPEG(tiff []byte) []byte {
+	b := []byte{0xFF, 0xD8}
+	b = append(b, 0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0)
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	b = append(b, 0xFF, 0xE1)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(app1)+2))
+	b = append(b, app1...)
+	return append(b, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9)
+}
+
+func TestParseEXIF(t *testing.T) {
+	le, be := tiffOrder(binary.LittleEndian), tiffOrder(binary.BigEndian)
+	camera := func(order tiffOrder, orientation uint16) []byte {
+		return exifJPEG(buildTIFF(order,
+			[]ifdEntry{
+				asciiEntry(exifTagMake, "Canon"),
+				asciiEntry(exifTagModel, "EOS 200D"),
+				shortEntry(order, exifTagOrientation, orientation),
+				asciiEntry(exifTagDateTime, "2024:01:02 10:00:00"),
+				{exifTagExifIFD, 4, 1, nil},
+			},
+			[]ifdEntry{asciiEntry(exifTagDateTimeOriginal, "2024:01:01 09:30:00")},
+		))
+	}
+	want := ExifInfo{Orientation: OrientationRotate90CW, Make: "Canon", Model: "EOS 200D", DateTime: "2024:01:01 09:30:00"}
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    ExifInfo
+		wantErr error
+		wantAny bool // any error
+	}{
+		{name: "little endian", in: camera(le, 6), want: want},
+		{name: "big endian", in: camera(be, 6), want: want},
+		{name: "fill bytes before marker", in: append([]byte{0xFF, 0xD8, 0xFF}, camera(le, 6)[2:]...), want: want},
+		{name: "short value inline", in: exifJPEG(buildTIFF(le, []ifdEntry{asciiEntry(exifTagMake, "LG"), shortEntry(le, exifTagOrientation, 3)})),
+			want: ExifInfo{Orientation: OrientationRotate180, Make: "LG"}},
+		{name: "IFD0 date without Exif IFD", in: exifJPEG(buildTIFF(be, []ifdEntry{asciiEntry(exifTagDateTime, "2024:01:02 10:00:00")})),
+			want: ExifInfo{Orientation: OrientationNormal, DateTime: "2024:01:02 10:00:00"}},
+		{name: "orientation out of range", in: camera(le, 9), want: ExifInfo{Orientation: OrientationNormal, Make: "Canon", Model: "EOS 200D", DateTime: "2024:01:01 09:30:00"}},
+		{name: "orientation with wrong type", in: exifJPEG(buildTIFF(le, []ifdEntry{{exifTagOrientation, 4, 1, le.AppendUint32(nil, 6)}})),
+			want: ExifInfo{Orientation: OrientationNormal}},
+		{name: "value out of range is skipped", in: exifJPEG([]byte("II\x2a\x00\x08\x00\x00\x00\x01\x00\x0f\x01\x02\x00\x0a\x00\x00\x00\xff\xff\x00\x00\x00\x00\x00\x00")),
+			want: ExifInfo{Orientation: OrientationNormal}},
+		{name: "no APP1", in: []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x04, 0, 0, 0xFF, 0xDA}, wantErr: ErrNoEXIF},
+		{name: "not a JPEG", in: []byte("\x89PNG\r\n\x1a\n"), wantAny: true},
+		{name: "truncated segment", in: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x10, 0x00, 'E'}, wantAny: true},
+		{name: "bad byte order", in: exifJPEG([]byte("XX\x00\x2a\x08\x00\x00\x00\x00\x00")), wantAny: true},
+		{name: "bad magic", in: exifJPEG([]byte("II\x2b\x00\x08\x00\x00\x00\x00\x00")), wantAny: true},
+		{name: "IFD offset out of range", in: exifJPEG([]byte("II\x2a\x00\xff\xff\x00\x00")), wantAny: true},
+		{name: "truncated IFD", in: exifJPEG([]byte("II\x2a\x00\x08\x00\x00\x00\x09\x00")), wantAny: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseEXIF(tt.in)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantAny:
+				if err == nil {
+					t.Fatalf("got %+v, want error", info)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case *info != tt.want:
+				t.Errorf("got %+v, want %+v", *info, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// a b
+	// c d
+	// e f
+	src := image.NewGray(image.Rect(0, 0, 2, 3))
+	copy(src.Pix, []byte{'a', 'b', 'c', 'd', 'e', 'f'})
+
+	tests := []struct {
+		orientation int
+		want        []string // rows
+	}{
+		{0, []string{"ab", "cd", "ef"}},
+		{OrientationNormal, []string{"ab", "cd", "ef"}},
+		{OrientationMirrorH, []string{"ba", "dc", "fe"}},
+		{OrientationRotate180, []string{"fe", "dc", "ba"}},
+		{OrientationMirrorV, []string{"ef", "cd", "ab"}},
+		{OrientationTranspose, []string{"ace", "bdf"}},
+		{OrientationRotate90CW, []string{"eca", "fdb"}},
+		{OrientationTransverse, []string{"fdb", "eca"}},
+		{OrientationRotate270CW, []string{"bdf", "ace"}},
+		{9, []string{"ab", "cd", "ef"}},
+	}
+	for _, tt := range tests {
+		out := ApplyOrientation(src, tt.orientation)
+		b := out.Bounds()
+		var rows []string
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			var row bytes.Buffer
+			for x := b.Min.X; x < b.Max.X; x++ {
+				row.WriteByte(color.GrayModel.Convert(out.At(x, y)).(color.Gray).Y)
+			}
+			rows = append(rows, row.String())
+		}
+		if len(rows) != len(tt.want) {
+			t.Errorf("orientation %d: got %q, want %q", tt.orientation, rows, tt.want)
+			continue
+		}
+		for i := range rows {
+			if rows[i] != tt.want[i] {
+				t.Errorf("orientation %d: got %q, want %q", tt.orientation, rows, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/common"
+	"github.com/makiuchi-d/gozxing/qrcode/detector"
+)
+
+// quietZoneModules is the white border added around the rectified crop;
+// the QR spec asks for 4 modules.
+const quietZoneModules = 4
+
+func init() {
+	RegisterDetector(finderDetector{})
+}
+
+// finderDetector is the pure-Go detector: it finds the three finder
+// patterns (and the alignment pattern where present) and warps the
+// quadrilateral they span onto an axis aligned square.
+type finderDetector struct{}
+
+func (finderDetector) Name() string { return "finder" }
+
+func (finderDetector) Detect(img image.Image) (*Detection, error) {
+	gray := toGray(img)
+
+	source := gozxing.NewLuminanceSourceFromImage(gray)
+	matrix, err := gozxing.NewHybridBinarizer(source).GetBlackMatrix()
+	if err != nil {
+		return nil, fmt.Errorf("binarize error: %v", err)
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+	info, err := detector.NewFinderPatternFinder(matrix, nil).Find(hints)
+	if err != nil {
+		return nil, fmt.Errorf("finder patterns not found: %v", err)
+	}
+
+	result, err := detector.NewDetector(matrix).ProcessFinderPatternInfo(info)
+	if err != nil {
+		return nil, fmt.Errorf("QR geometry error: %v", err)
+	}
+	dimension := result.GetBits().GetWidth()
+
+	var alignment *detector.AlignmentPattern
+	if points := result.GetPoints(); len(points) > 3 {
+		alignment, _ = points[3].(*detector.AlignmentPattern)
+	}
+	transform := detector.Detector_createTransform(
+		info.GetTopLeft(), info.GetTopRight(), info.GetBottomLeft(), alignment, dimension)
+
+	// Module space → image space for the outer corners of the symbol.
+	d := float64(dimension)
+	corners := []float64{0, 0, d, 0, d, d, 0, d}
+	transform.TransformPoints(corners)
+	min := img.Bounds().Min
+	for i := 0; i < len(corners); i += 2 {
+		corners[i] += float64(min.X)
+		corners[i+1] += float64(min.Y)
+	}
+
+	moduleSize := (info.GetTopLeft().GetEstimatedModuleSize() +
+		info.GetTopRight().GetEstimatedModuleSize() +
+		info.GetBottomLeft().GetEstimatedModuleSize()) / 3
+
+	return &Detection{
+		Image: warpQR(gray, transform, dimension, moduleSize),
+		Corners: [4]Point{
+			{corners[0], corners[1]},
+			{corners[2], corners[3]},
+			{corners[4], corners[5]},
+			{corners[6], corners[7]},
+		},
+		Detector: "finder",
+	}, nil
+}
+
+// warpQR samples the symbol through transform (module coordinates →
+// source pixels) into a square image with a white quiet zone.
+func warpQR(src *image.Gray, transform *common.PerspectiveTransform, dimension int, moduleSize float64) *image.Gray {
+	ppm := int(math.Round(moduleSize))
+	if ppm < 4 {
+		ppm = 4
+	}
+	if ppm > 10 {
+		ppm = 10
+	}
+
+	side := (dimension + 2*quietZoneModules) * ppm
+	out := image.NewGray(image.Rect(0, 0, side, side))
+
+	xs := make([]float64, side)
+	ys := make([]float64, side)
+	for oy := 0; oy < side; oy++ {
+		my := (float64(oy)+0.5)/float64(ppm) - quietZoneModules
+		for ox := 0; ox < side; ox++ {
+			xs[ox] = (float64(ox)+0.5)/float64(ppm) - quietZoneModules
+			ys[ox] = my
+		}
+		transform.TransformPointsXY(xs, ys)
+
+		row := out.Pix[oy*out.Stride:]
+		for ox := 0; ox < side; ox++ {
+			mx := (float64(ox)+0.5)/float64(ppm) - quietZoneModules
+			if mx < 0 || my < 0 || mx >= float64(dimension) || my >= float64(dimension) {
+				row[ox] = 0xFF
+				continue
+			}
+			row[ox] = sampleBilinear(src, xs[ox], ys[ox])
+		}
+	}
+	return out
+}
+
+// sampleBilinear reads src at a fractional pixel position; positions
+// outside the image are treated as white.
+func sampleBilinear(src *image.Gray, x, y float64) uint8 {
+	x -= 0.5
+	y -= 0.5
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	at := func(px, py int) float64 {
+		if px < 0 || py < 0 || px >= src.Rect.Dx() || py >= src.Rect.Dy() {
+			return 0xFF
+		}
+		return float64(src.Pix[py*src.Stride+px])
+	}
+
+	v := at(x0, y0)*(1-fx)*(1-fy) +
+		at(x0+1, y0)*fx*(1-fy) +
+		at(x0, y0+1)*(1-fx)*fy +
+		at(x0+1, y0+1)*fx*fy
+	return uint8(math.Round(v))
+}
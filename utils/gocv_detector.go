@@ -0,0 +1,113 @@
+//go:build cgo && gocv
+
+package utils
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/makiuchi-d/gozxing/common"
+	"gocv.io/x/gocv"
+)
+
+func init() {
+	RegisterDetector(opencvDetector{})
+}
+
+// opencvDetector uses OpenCV's QRCodeDetector. Besides the corners it
+// usually decodes the code as well; that text comes back through a C
+// string, so payloads containing NUL bytes are truncated and the decoder
+// chain still runs on the crop.
+type opencvDetector struct{}
+
+func (opencvDetector) Name() string { return "opencv" }
+
+func (opencvDetector) Detect(img image.Image) (*Detection, error) {
+	gray := toGray(img)
+	mat, err := gocv.ImageGrayToMatGray(gray)
+	if err != nil {
+		return nil, fmt.Errorf("opencv: image conversion failed: %v", err)
+	}
+	defer mat.Close()
+
+	qr := gocv.NewQRCodeDetector()
+	defer qr.Close()
+
+	points := gocv.NewMat()
+	defer points.Close()
+	straight := gocv.NewMat()
+	defer straight.Close()
+
+	text := qr.DetectAndDecode(mat, &points, &straight)
+	if points.Empty() || points.Total() < 4 {
+		return nil, fmt.Errorf("opencv: no QR code found")
+	}
+
+	var corners [4]Point
+	for i := 0; i < 4; i++ {
+		v := points.GetVecfAt(0, i)
+		corners[i] = Point{X: float64(v[0]), Y: float64(v[1])}
+	}
+
+	det := &Detection{
+		Image:    warpQuad(gray, corners),
+		Corners:  offsetCorners(corners, img.Bounds().Min),
+		Detector: "opencv",
+	}
+	if text != "" {
+		det.Payload = []byte(text)
+	}
+	return det, nil
+}
+
+// warpQuad rectifies the quadrilateral given by corners (TL, TR, BR, BL)
+// into a square with a white border of one eighth of the side.
+func warpQuad(src *image.Gray, corners [4]Point) *image.Gray {
+	side := 0.0
+	for i := 0; i < 4; i++ {
+		a, b := corners[i], corners[(i+1)%4]
+		side = math.Max(side, math.Hypot(b.X-a.X, b.Y-a.Y))
+	}
+	n := int(math.Ceil(side))
+	if n < 21 {
+		n = 21
+	}
+	border := n / 8
+
+	s := float64(n)
+	transform := common.PerspectiveTransform_QuadrilateralToQuadrilateral(
+		0, 0, s, 0, s, s, 0, s,
+		corners[0].X, corners[0].Y, corners[1].X, corners[1].Y,
+		corners[2].X, corners[2].Y, corners[3].X, corners[3].Y)
+
+	total := n + 2*border
+	out := image.NewGray(image.Rect(0, 0, total, total))
+	xs := make([]float64, total)
+	ys := make([]float64, total)
+	for oy := 0; oy < total; oy++ {
+		for ox := 0; ox < total; ox++ {
+			xs[ox] = float64(ox-border) + 0.5
+			ys[ox] = float64(oy-border) + 0.5
+		}
+		transform.TransformPointsXY(xs, ys)
+
+		row := out.Pix[oy*out.Stride:]
+		for ox := 0; ox < total; ox++ {
+			if ox < border || oy < border || ox >= border+n || oy >= border+n {
+				row[ox] = 0xFF
+				continue
+			}
+			row[ox] = sampleBilinear(src, xs[ox], ys[ox])
+		}
+	}
+	return out
+}
+
+func offsetCorners(corners [4]Point, min image.Point) [4]Point {
+	for i := range corners {
+		corners[i].X += float64(min.X)
+		corners[i].Y += float64(min.Y)
+	}
+	return corners
+}
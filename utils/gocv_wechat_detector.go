@@ -0,0 +1,92 @@
+//go:build cgo && gocv && wechat
+
+package utils
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gocv.io/x/gocv"
+	"gocv.io/x/gocv/contrib"
+)
+
+func init() {
+	RegisterDetector(&wechatDetector{})
+}
+
+// wechatDetector uses the CNN based WeChat QR detector from
+// opencv_contrib. Its models are loaded from QR_WECHAT_MODEL_DIR, which
+// must hold detect.prototxt, detect.caffemodel, sr.prototxt and
+// sr.caffemodel.
+type wechatDetector struct {
+	once sync.Once
+	mu   sync.Mutex
+	qr   *contrib.WeChatQRCode
+	err  error
+}
+
+func (*wechatDetector) Name() string { return "wechat" }
+
+func (w *wechatDetector) load() {
+	dir := os.Getenv("QR_WECHAT_MODEL_DIR")
+	if dir == "" {
+		w.err = fmt.Errorf("wechat: QR_WECHAT_MODEL_DIR not set")
+		return
+	}
+	files := []string{"detect.prototxt", "detect.caffemodel", "sr.prototxt", "sr.caffemodel"}
+	for i, f := range files {
+		files[i] = filepath.Join(dir, f)
+		if _, err := os.Stat(files[i]); err != nil {
+			w.err = fmt.Errorf("wechat: model missing: %v", err)
+			return
+		}
+	}
+	w.qr = contrib.NewWeChatQRCode(files[0], files[1], files[2], files[3])
+}
+
+func (w *wechatDetector) Detect(img image.Image) (*Detection, error) {
+	w.once.Do(w.load)
+	if w.err != nil {
+		return nil, w.err
+	}
+
+	gray := toGray(img)
+	mat, err := gocv.ImageGrayToMatGray(gray)
+	if err != nil {
+		return nil, fmt.Errorf("wechat: image conversion failed: %v", err)
+	}
+	defer mat.Close()
+
+	// The WeChat model is not safe for concurrent use.
+	w.mu.Lock()
+	var points []gocv.Mat
+	texts := w.qr.DetectAndDecode(mat, &points)
+	w.mu.Unlock()
+	defer func() {
+		for _, p := range points {
+			p.Close()
+		}
+	}()
+
+	if len(points) == 0 || points[0].Rows() < 4 {
+		return nil, fmt.Errorf("wechat: no QR code found")
+	}
+
+	var corners [4]Point
+	for i := 0; i < 4; i++ {
+		corners[i] = Point{X: float64(points[0].GetFloatAt(i, 0)), Y: float64(points[0].GetFloatAt(i, 1))}
+	}
+
+	det := &Detection{
+		Image:    warpQuad(gray, corners),
+		Corners:  offsetCorners(corners, img.Bounds().Min),
+		Detector: "wechat",
+	}
+	if len(texts) > 0 && texts[0] != "" {
+		det.Payload = []byte(texts[0])
+	}
+	return det, nil
+}
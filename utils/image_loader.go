@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+const (
+	ImageFormatPNG  = "png"
+	ImageFormatJPEG = "jpeg"
+	ImageFormatGIF  = "gif"
+	ImageFormatBMP  = "bmp"
+	ImageFormatTIFF = "tiff"
+	ImageFormatWebP = "webp"
+	ImageFormatHEIC = "heic"
+	ImageFormatAVIF = "avif"
+	ImageFormatPDF  = "pdf"
+)
+
+// maxTIFFPages bounds how many IFDs of a multi-page TIFF are decoded.
+const maxTIFFPages = 32
+
+// UnsupportedFormatError is returned by LoadImage for data it recognises
+// but cannot decode (Format is set), or does not recognise at all.
+type UnsupportedFormatError struct {
+	Format string
+	Err    error
+}
+
+func (e *UnsupportedFormatError) Error() string {
+	if e.Format == "" {
+		return "unsupported image format: unrecognized data"
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("unsupported image format %s: %v", e.Format, e.Err)
+	}
+	return "unsupported image format " + e.Format
+}
+
+func (e *UnsupportedFormatError) Unwrap() error { return e.Err }
+
+// LoadedImage is a decoded upload. Pages holds one image for most formats
+// and every page of a multi-page TIFF. Exif is set for JPEGs carrying EXIF
+// data, whose orientation has already been applied to the pixels.
+type LoadedImage struct {
+	Format string
+	Pages  []image.Image
+	Exif   *ExifInfo
+}
+
+// SniffImageFormat identifies an image container by its magic bytes,
+// returning "" when nothing matches.
+func SniffImageFormat(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		return ImageFormatPNG
+	case bytes.HasPrefix(b, []byte{0xFF, 0xD8, 0xFF}):
+		return ImageFormatJPEG
+	case bytes.HasPrefix(b, []byte("GIF87a")), bytes.HasPrefix(b, []byte("GIF89a")):
+		return ImageFormatGIF
+	case bytes.HasPrefix(b, []byte("BM")) && len(b) >= 14:
+		return ImageFormatBMP
+	case bytes.HasPrefix(b, []byte("II*\x00")), bytes.HasPrefix(b, []byte("MM\x00*")):
+		return ImageFormatTIFF
+	case len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "WEBP":
+		return ImageFormatWebP
+	case bytes.HasPrefix(b, []byte("%PDF-")):
+		return ImageFormatPDF
+	case len(b) >= 12 && string(b[4:8]) == "ftyp":
+		switch string(b[8:12]) {
+		case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+			return ImageFormatHEIC
+		case "avif", "avis":
+			return ImageFormatAVIF
+		}
+	}
+	if f, ok := SniffJP2(b); ok {
+		return f
+	}
+	return ""
+}
+
+// LoadOptions carry what some formats need beyond the bytes themselves.
+type LoadOptions struct {
+	// PDFPassword opens password-protected PDFs, such as e-Aadhaar
+	// downloads.
+	PDFPassword string
+}
+
+// LoadImage sniffs and decodes an uploaded image. PDFs yield their
+// embedded raster images, largest first, followed by rendered pages when
+// a PageRenderer is selected.
+func LoadImage(b []byte, opts LoadOptions) (*LoadedImage, error) {
+	format := SniffImageFormat(b)
+	loaded := &LoadedImage{Format: format}
+
+	var img image.Image
+	var err error
+	switch format {
+	case ImageFormatPNG:
+		img, err = png.Decode(bytes.NewReader(b))
+	case ImageFormatJPEG:
+		if img, err = jpeg.Decode(bytes.NewReader(b)); err == nil {
+			img, loaded.Exif = orientJPEG(img, b)
+		}
+	case ImageFormatGIF:
+		// first frame only
+		img, err = gif.Decode(bytes.NewReader(b))
+	case ImageFormatBMP:
+		img, err = bmp.Decode(bytes.NewReader(b))
+	case ImageFormatWebP:
+		img, err = webp.Decode(bytes.NewReader(b))
+	case ImageFormatTIFF:
+		pages, err := decodeTIFFPages(b)
+		if err != nil {
+			return nil, fmt.Errorf("tiff decode error: %v", err)
+		}
+		loaded.Pages = pages
+		return loaded, nil
+	case ImageFormatPDF:
+		pages, err := loadPDF(b, opts.PDFPassword)
+		if err != nil {
+			return nil, err
+		}
+		loaded.Pages = pages
+		return loaded, nil
+	case FormatJP2, FormatJ2K:
+		img, err = DecodeJPEG2000(b)
+		if errors.Is(err, ErrJPEG2000Unsupported) {
+			return nil, &UnsupportedFormatError{Format: format, Err: err}
+		}
+	default:
+		return nil, &UnsupportedFormatError{Format: format}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s decode error: %v", format, err)
+	}
+	loaded.Pages = []image.Image{img}
+	return loaded, nil
+}
+
+// DecodeImage is LoadImage for callers that only want the first page.
+func DecodeImage(b []byte) (image.Image, error) {
+	loaded, err := LoadImage(b, LoadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return loaded.Pages[0], nil
+}
+
+func loadPDF(b []byte, password string) ([]image.Image, error) {
+	pages, err := ExtractPDFImages(b, password)
+	if err != nil {
+		return nil, err
+	}
+	if r := getPageRenderer(); r != nil {
+		rendered, err := r.RenderPages(b, password)
+		if err != nil {
+			log.Printf("[pdf] %s renderer failed: %v\n", r.Name(), err)
+		} else {
+			log.Printf("[pdf] %s rendered %d page(s)\n", r.Name(), len(rendered))
+			pages = append(pages, rendered...)
+		}
+	}
+	if len(pages) == 0 {
+		return nil, ErrPDFNoImages
+	}
+	return pages, nil
+}
+
+// orientJPEG turns a decoded JPEG upright according to its EXIF data.
+func orientJPEG(img image.Image, b []byte) (image.Image, *ExifInfo) {
+	exif, err := ParseEXIF(b)
+	if err != nil {
+		if err != ErrNoEXIF {
+			log.Println("[exif] Ignoring unreadable EXIF:", err)
+		}
+		return img, nil
+	}
+	if exif.Orientation != OrientationNormal {
+		log.Printf("[exif] Applying orientation %d\n", exif.Orientation)
+		img = ApplyOrientation(img, exif.Orientation)
+	}
+	return img, exif
+}
+
+// decodeTIFFPages decodes every page of a TIFF. x/image/tiff only reads
+// the first IFD, so each later page is decoded from a copy whose header
+// points at that page's IFD instead. Pages that fail to decode are
+// skipped as long as at least one succeeds.
+func decodeTIFFPages(b []byte) ([]image.Image, error) {
+	offsets, err := tiffIFDOffsets(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []image.Image
+	var errs []error
+	patched := make([]byte, len(b))
+	copy(patched, b)
+	order := tiffByteOrder(b)
+	for i, off := range offsets {
+		order.PutUint32(patched[4:8], off)
+		img, err := tiff.Decode(bytes.NewReader(patched))
+		if err != nil {
+			log.Printf("[image] TIFF page %d: %v\n", i+1, err)
+			errs = append(errs, fmt.Errorf("page %d: %v", i+1, err))
+			continue
+		}
+		pages = append(pages, img)
+	}
+	if len(pages) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(offsets) > 1 {
+		log.Printf("[image] TIFF has %d pages, %d decoded\n", len(offsets), len(pages))
+	}
+	return pages, nil
+}
+
+func tiffByteOrder(b []byte) binary.ByteOrder {
+	if b[0] == 'M' {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// tiffIFDOffsets follows the IFD chain from the header.
+func tiffIFDOffsets(b []byte) ([]uint32, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("header too short")
+	}
+	order := tiffByteOrder(b)
+	seen := make(map[uint32]bool)
+	var offsets []uint32
+	for off := order.Uint32(b[4:8]); off != 0 && len(offsets) < maxTIFFPages; {
+		if seen[off] || uint64(off)+2 > uint64(len(b)) {
+			break
+		}
+		seen[off] = true
+		offsets = append(offsets, off)
+
+		next := uint64(off) + 2 + 12*uint64(order.Uint16(b[off:]))
+		if next+4 > uint64(len(b)) {
+			break
+		}
+		off = order.Uint32(b[next:])
+	}
+	if len(offsets) == 0 {
+		return nil, fmt.Errorf("no image file directory")
+	}
+	return offsets, nil
+}
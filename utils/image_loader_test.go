@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+// tiffPages writes an uncompressed 8-bit grayscale TIFF with one IFD per
+// page. compression overrides the Compression tag of the page with that
+// index, to make it undecodable.
+func tiffPages(order tiffOrder, pages []*image.Gray, compression map[int]uint16) []byte {
+	b := []byte("II")
+	if order == tiffOrder(binary.BigEndian) {
+		b = []byte("MM")
+	}
+	b = order.AppendUint16(b, 42)
+	b = order.AppendUint32(b, 0)
+	nextPos := 4
+
+	for i, p := range pages {
+		w, h := p.Rect.Dx(), p.Rect.Dy()
+		data := len(b)
+		b = append(b, p.Pix...)
+		if len(b)%2 == 1 {
+			b = append(b, 0)
+		}
+		order.PutUint32(b[nextPos:], uint32(len(b)))
+
+		comp := uint16(1)
+		if c, ok := compression[i]; ok {
+			comp = c
+		}
+		entries := []struct {
+			tag, typ uint16
+			value    uint32
+		}{
+			{256, 4, uint32(w)},     // ImageWidth
+			{257, 4, uint32(h)},     // ImageLength
+			{258, 3, 8},             // BitsPerSample
+			{259, 3, uint32(comp)},  // Compression
+			{262, 3, 1},             // PhotometricInterpretation: black is zero
+			{273, 4, uint32(data)},  // StripOffsets
+			{277, 3, 1},             // SamplesPerPixel
+			{278, 4, uint32(h)},     // RowsPerStrip
+			{279, 4, uint32(w * h)}, // StripByteCounts
+		}
+		b = order.AppendUint16(b, uint16(len(entries)))
+		for _, e := range entries {
+			b = order.AppendUint16(b, e.tag)
+			b = order.AppendUint16(b, e.typ)
+			b = order.AppendUint32(b, 1)
+			if e.typ == 3 {
+				b = order.AppendUint16(b, uint16(e.value))
+				b = order.AppendUint16(b, 0)
+			} else {
+				b = order.AppendUint32(b, e.value)
+			}
+		}
+		nextPos = len(b)
+		b = order.AppendUint32(b, 0)
+	}
+	return b
+}
+
+// grayPage is a w x h page filled with v.
+func grayPage(w, h int, v uint8) *image.Gray {
+	g := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range g.Pix {
+		g.Pix[i] = v
+	}
+	return g
+}
+
+func TestLoadImageTIFFPages(t *testing.T) {
+	le, be := tiffOrder(binary.LittleEndian), tiffOrder(binary.BigEndian)
+	three := []*image.Gray{grayPage(4, 3, 10), grayPage(5, 2, 20), grayPage(2, 6, 30)}
+	many := make([]*image.Gray, maxTIFFPages+3)
+	for i := range many {
+		many[i] = grayPage(2, 2, uint8(i))
+	}
+
+	// The last page's next-IFD offset points back at the first.
+	loop := tiffPages(le, three, nil)
+	first := le.Uint32(loop[4:])
+	le.PutUint32(loop[len(loop)-4:], first)
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    []uint8 // fill value of each decoded page
+		wantErr bool
+	}{
+		{name: "single page", in: tiffPages(le, three[:1], nil), want: []uint8{10}},
+		{name: "little endian pages", in: tiffPages(le, three, nil), want: []uint8{10, 20, 30}},
+		{name: "big endian pages", in: tiffPages(be, three, nil), want: []uint8{10, 20, 30}},
+		{name: "IFD loop", in: loop, want: []uint8{10, 20, 30}},
+		{name: "bad middle page is skipped", in: tiffPages(le, three, map[int]uint16{1: 99}), want: []uint8{10, 30}},
+		{name: "page cap", in: tiffPages(le, many, nil), want: func() []uint8 {
+			v := make([]uint8, maxTIFFPages)
+			for i := range v {
+				v[i] = uint8(i)
+			}
+			return v
+		}()},
+		{name: "no decodable page", in: tiffPages(be, three[:2], map[int]uint16{0: 99, 1: 99}), wantErr: true},
+		{name: "IFD out of range", in: []byte("II\x2a\x00\xff\x00\x00\x00"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := LoadImage(tt.in, LoadOptions{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %d pages, want error", len(loaded.Pages))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Format != ImageFormatTIFF {
+				t.Errorf("format = %q", loaded.Format)
+			}
+			if len(loaded.Pages) != len(tt.want) {
+				t.Fatalf("got %d pages, want %d", len(loaded.Pages), len(tt.want))
+			}
+			for i, page := range loaded.Pages {
+				g, ok := page.(*image.Gray)
+				if !ok {
+					t.Fatalf("page %d is %T", i+1, page)
+				}
+				if g.Pix[0] != tt.want[i] || g.Pix[len(g.Pix)-1] != tt.want[i] {
+					t.Errorf("page %d filled with %d, want %d", i+1, g.Pix[0], tt.want[i])
+				}
+			}
+		})
+	}
+}
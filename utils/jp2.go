@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	FormatJP2 = "jp2"
+	FormatJ2K = "j2k"
+)
+
+var (
+	jp2Signature = []byte{0x00, 0x00, 0x00, 0x0C, 'j', 'P', ' ', ' ', 0x0D, 0x0A, 0x87, 0x0A}
+	j2kSOC       = []byte{0xFF, 0x4F, 0xFF, 0x51}
+)
+
+// ErrJPEG2000Unsupported is returned when the binary was built without a
+// JPEG2000 decoder (see the openjpeg build tag).
+var ErrJPEG2000Unsupported = errors.New("JPEG2000 decoding not compiled into this build")
+
+// JP2Info is what can be learned about a JPEG2000 image from its headers
+// alone, without decoding any pixels.
+type JP2Info struct {
+	Format     string `json:"format"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Components int    `json:"components"`
+}
+
+// SniffJP2 reports whether b is a JP2 file or a raw J2K codestream.
+func SniffJP2(b []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(b, jp2Signature):
+		return FormatJP2, true
+	case bytes.HasPrefix(b, j2kSOC):
+		return FormatJ2K, true
+	}
+	return "", false
+}
+
+// ParseJP2Header reads the image size from the SIZ marker of the
+// codestream, locating it inside the jp2c box for JP2 files.
+func ParseJP2Header(b []byte) (*JP2Info, error) {
+	format, ok := SniffJP2(b)
+	if !ok {
+		return nil, fmt.Errorf("not a JPEG2000 image")
+	}
+
+	cs := b
+	if format == FormatJP2 {
+		var err error
+		if cs, err = jp2Codestream(b); err != nil {
+			return nil, err
+		}
+	}
+
+	// SOC, then SIZ: Lsiz(2) Rsiz(2) Xsiz(4) Ysiz(4) XOsiz(4) YOsiz(4) ... Csiz(2)
+	if len(cs) < 4+2+2+16+16+2 || !bytes.HasPrefix(cs, j2kSOC) {
+		return nil, fmt.Errorf("JPEG2000 codestream missing SIZ marker")
+	}
+	siz := cs[4:]
+	xsiz := binary.BigEndian.Uint32(siz[4:])
+	ysiz := binary.BigEndian.Uint32(siz[8:])
+	xosiz := binary.BigEndian.Uint32(siz[12:])
+	yosiz := binary.BigEndian.Uint32(siz[16:])
+	csiz := binary.BigEndian.Uint16(siz[36:])
+	if xsiz <= xosiz || ysiz <= yosiz {
+		return nil, fmt.Errorf("JPEG2000 SIZ has empty image area")
+	}
+
+	return &JP2Info{
+		Format:     format,
+		Width:      int(xsiz - xosiz),
+		Height:     int(ysiz - yosiz),
+		Components: int(csiz),
+	}, nil
+}
+
+// jp2Codestream walks the top-level JP2 boxes and returns the contents
+// of the contiguous codestream (jp2c) box.
+func jp2Codestream(b []byte) ([]byte, error) {
+	for pos := 0; pos+8 <= len(b); {
+		size := uint64(binary.BigEndian.Uint32(b[pos:]))
+		typ := string(b[pos+4 : pos+8])
+		hdr := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(b) - pos)
+		case 1:
+			if pos+16 > len(b) {
+				return nil, fmt.Errorf("truncated JP2 box")
+			}
+			size = binary.BigEndian.Uint64(b[pos+8:])
+			hdr = 16
+		}
+		// An XL box length can be anything up to 2^64-1; compare it with
+		// what is left rather than computing an end offset that may wrap.
+		if size < hdr || size > uint64(len(b)-pos) {
+			return nil, fmt.Errorf("invalid JP2 box %q", typ)
+		}
+		if typ == "jp2c" {
+			return b[uint64(pos)+hdr : uint64(pos)+size], nil
+		}
+		pos += int(size)
+	}
+	return nil, fmt.Errorf("JP2 file has no codestream box")
+}
+
+// Photo is a resident photo re-encoded into a browser friendly format.
+type Photo struct {
+	SourceFormat string `json:"source_format"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	MimeType     string `json:"mime_type,omitempty"`
+	Data         string `json:"data,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ConvertPhoto decodes an embedded photo (JPEG2000, JPEG or PNG) and
+// re-encodes it as "png" or "jpeg", base64 encoded. When the pixels
+// cannot be decoded the header information is still returned together
+// with the error.
+func ConvertPhoto(raw []byte, format string) (*Photo, error) {
+	photo := &Photo{}
+
+	var img image.Image
+	var err error
+	if jf, ok := SniffJP2(raw); ok {
+		photo.SourceFormat = jf
+		if info, herr := ParseJP2Header(raw); herr == nil {
+			photo.Width, photo.Height = info.Width, info.Height
+		}
+		img, err = DecodeJPEG2000(raw)
+	} else {
+		var name string
+		img, name, err = image.Decode(bytes.NewReader(raw))
+		photo.SourceFormat = name
+	}
+	if err != nil {
+		photo.Error = err.Error()
+		return photo, err
+	}
+
+	b := img.Bounds()
+	photo.Width, photo.Height = b.Dx(), b.Dy()
+
+	encoded, mime, err := EncodePhoto(img, format)
+	if err != nil {
+		photo.Error = err.Error()
+		return photo, err
+	}
+	photo.MimeType = mime
+	photo.Data = base64.StdEncoding.EncodeToString(encoded)
+	return photo, nil
+}
+
+// EncodePhoto encodes img as "jpeg" or "png" (the default).
+func EncodePhoto(img image.Image, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg", "jpg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	case "", "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+	return nil, "", fmt.Errorf("unsupported photo format %q", format)
+}
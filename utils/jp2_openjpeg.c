@@ -0,0 +1,129 @@
+//go:build cgo && openjpeg
+
+#include <openjpeg.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+    const unsigned char *data;
+    OPJ_SIZE_T size;
+    OPJ_SIZE_T pos;
+} mem_stream;
+
+static OPJ_SIZE_T mem_read(void *buf, OPJ_SIZE_T n, void *user) {
+    mem_stream *m = (mem_stream *)user;
+    if (m->pos >= m->size) return (OPJ_SIZE_T)-1;
+    if (n > m->size - m->pos) n = m->size - m->pos;
+    memcpy(buf, m->data + m->pos, n);
+    m->pos += n;
+    return n;
+}
+
+static OPJ_OFF_T mem_skip(OPJ_OFF_T n, void *user) {
+    mem_stream *m = (mem_stream *)user;
+    if (n < 0) {
+        if ((OPJ_SIZE_T)(-n) > m->pos) n = -(OPJ_OFF_T)m->pos;
+    } else if ((OPJ_SIZE_T)n > m->size - m->pos) {
+        n = (OPJ_OFF_T)(m->size - m->pos);
+    }
+    m->pos += n;
+    return n;
+}
+
+static OPJ_BOOL mem_seek(OPJ_OFF_T n, void *user) {
+    mem_stream *m = (mem_stream *)user;
+    if (n < 0 || (OPJ_SIZE_T)n > m->size) return OPJ_FALSE;
+    m->pos = (OPJ_SIZE_T)n;
+    return OPJ_TRUE;
+}
+
+static void quiet(const char *msg, void *user) { (void)msg; (void)user; }
+
+// Decodes into 8-bit interleaved samples (1 or 3 components).
+// The caller frees *output with free().
+int decode_jp2_openjpeg(const unsigned char *data, int size, int is_j2k,
+                        unsigned char **output, int *width, int *height,
+                        int *components) {
+
+    mem_stream m = { data, (OPJ_SIZE_T)size, 0 };
+
+    opj_stream_t *stream = opj_stream_create(OPJ_J2K_STREAM_CHUNK_SIZE, OPJ_TRUE);
+    if (!stream) return -1;
+    opj_stream_set_user_data(stream, &m, NULL);
+    opj_stream_set_user_data_length(stream, m.size);
+    opj_stream_set_read_function(stream, mem_read);
+    opj_stream_set_skip_function(stream, mem_skip);
+    opj_stream_set_seek_function(stream, mem_seek);
+
+    opj_codec_t *codec = opj_create_decompress(is_j2k ? OPJ_CODEC_J2K : OPJ_CODEC_JP2);
+    if (!codec) {
+        opj_stream_destroy(stream);
+        return -2;
+    }
+    opj_set_error_handler(codec, quiet, NULL);
+    opj_set_warning_handler(codec, quiet, NULL);
+    opj_set_info_handler(codec, quiet, NULL);
+
+    opj_dparameters_t params;
+    opj_set_default_decoder_parameters(&params);
+    if (!opj_setup_decoder(codec, &params)) {
+        opj_destroy_codec(codec);
+        opj_stream_destroy(stream);
+        return -3;
+    }
+
+    opj_image_t *img = NULL;
+    if (!opj_read_header(stream, codec, &img) ||
+        !opj_decode(codec, stream, img) ||
+        !opj_end_decompress(codec, stream)) {
+        if (img) opj_image_destroy(img);
+        opj_destroy_codec(codec);
+        opj_stream_destroy(stream);
+        return -4;
+    }
+    opj_destroy_codec(codec);
+    opj_stream_destroy(stream);
+
+    if (img->numcomps < 1) {
+        opj_image_destroy(img);
+        return -5;
+    }
+
+    int n = img->numcomps >= 3 ? 3 : 1;
+    int w = (int)img->comps[0].w;
+    int h = (int)img->comps[0].h;
+
+    unsigned char *out = (unsigned char *)malloc((size_t)w * h * n);
+    if (!out) {
+        opj_image_destroy(img);
+        return -6;
+    }
+
+    for (int c = 0; c < n; c++) {
+        opj_image_comp_t *comp = &img->comps[c];
+        int shift = (int)comp->prec - 8;
+        int offset = comp->sgnd ? (1 << (comp->prec - 1)) : 0;
+        for (int y = 0; y < h; y++) {
+            int sy = y / (int)comp->dy;
+            if (sy >= (int)comp->h) sy = (int)comp->h - 1;
+            for (int x = 0; x < w; x++) {
+                int sx = x / (int)comp->dx;
+                if (sx >= (int)comp->w) sx = (int)comp->w - 1;
+                int v = comp->data[sy * (int)comp->w + sx] + offset;
+                if (shift > 0) v >>= shift;
+                else if (shift < 0) v <<= -shift;
+                if (v < 0) v = 0;
+                if (v > 255) v = 255;
+                out[(y * w + x) * n + c] = (unsigned char)v;
+            }
+        }
+    }
+
+    *output = out;
+    *width = w;
+    *height = h;
+    *components = n;
+
+    opj_image_destroy(img);
+    return 0;
+}
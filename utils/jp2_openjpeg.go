@@ -0,0 +1,70 @@
+//go:build cgo && openjpeg
+
+package utils
+
+/*
+#cgo windows CFLAGS: -IC:/msys64/mingw64/include/openjpeg-2.5
+#cgo windows LDFLAGS: -LC:/msys64/mingw64/lib -lopenjp2
+#cgo !windows pkg-config: libopenjp2
+
+#include <stdlib.h>
+
+// Declaration only — actual implementation lives in jp2_openjpeg.c
+int decode_jp2_openjpeg(const unsigned char *data, int size, int is_j2k,
+                        unsigned char **output, int *width, int *height,
+                        int *components);
+*/
+import "C"
+import (
+	"fmt"
+	"image"
+	"log"
+	"unsafe"
+)
+
+// DecodeJPEG2000 decodes a JP2 file or J2K codestream using OpenJPEG.
+func DecodeJPEG2000(b []byte) (image.Image, error) {
+	format, ok := SniffJP2(b)
+	if !ok {
+		return nil, fmt.Errorf("not a JPEG2000 image")
+	}
+	log.Printf("[openjpeg] Decoding %s photo, %d bytes\n", format, len(b))
+
+	isJ2K := C.int(0)
+	if format == FormatJ2K {
+		isJ2K = 1
+	}
+
+	var out *C.uchar
+	var width, height, comps C.int
+	result := C.decode_jp2_openjpeg(
+		(*C.uchar)(unsafe.Pointer(&b[0])),
+		C.int(len(b)),
+		isJ2K,
+		&out,
+		&width,
+		&height,
+		&comps,
+	)
+	if result != 0 {
+		return nil, fmt.Errorf("openjpeg decode failed: code %d", result)
+	}
+	defer C.free(unsafe.Pointer(out))
+
+	w, h, n := int(width), int(height), int(comps)
+	pix := C.GoBytes(unsafe.Pointer(out), C.int(w*h*n))
+
+	if n == 1 {
+		return &image.Gray{Pix: pix, Stride: w, Rect: image.Rect(0, 0, w, h)}, nil
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < w*h; i++ {
+		img.Pix[i*4] = pix[i*n]
+		img.Pix[i*4+1] = pix[i*n+1]
+		img.Pix[i*4+2] = pix[i*n+2]
+		img.Pix[i*4+3] = 0xFF
+	}
+	log.Printf("[openjpeg] SUCCESS: %dx%d, %d components\n", w, h, n)
+	return img, nil
+}
@@ -0,0 +1,13 @@
+//go:build !(cgo && openjpeg)
+
+package utils
+
+import "image"
+
+// DecodeJPEG2000 needs the openjpeg build tag and cgo; without them only
+// the header information from ParseJP2Header is available, and
+// GET /decode/:id/photo serves the original JPEG2000 bytes instead of a
+// PNG or JPEG.
+func DecodeJPEG2000(b []byte) (image.Image, error) {
+	return nil, ErrJPEG2000Unsupported
+}
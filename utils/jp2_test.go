@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// j2kHeader is a codestream start: SOC and a SIZ marker for a
+// width x height image with comps components.
+func j2kHeader(width, height uint32, comps uint16) []byte {
+	siz := make([]byte, 38+3*int(comps))
+	binary.BigEndian.PutUint16(siz, uint16(len(siz)))
+	binary.BigEndian.PutUint32(siz[4:], width)
+	binary.BigEndian.PutUint32(siz[8:], height)
+	binary.BigEndian.PutUint16(siz[36:], comps)
+	return append([]byte{0xFF, 0x4F, 0xFF, 0x51}, siz...)
+}
+
+func jp2Box(typ string, data []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	return append(append(box, typ...), data...)
+}
+
+// jp2XLBox writes a box with a 64-bit length field of size.
+func jp2XLBox(typ string, size uint64, data []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, 1)
+	box = append(box, typ...)
+	box = binary.BigEndian.AppendUint64(box, size)
+	return append(box, data...)
+}
+
+func jp2File(boxes ...[]byte) []byte {
+	return bytes.Join(append([][]byte{jp2Signature}, boxes...), nil)
+}
+
+func TestParseJP2Header(t *testing.T) {
+	cs := j2kHeader(120, 160, 3)
+	ftypData := []byte("jp2 \x00\x00\x00\x00jp2 ")
+	ftyp := jp2Box("ftyp", ftypData)
+	want := JP2Info{FormatJP2, 120, 160, 3}
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    JP2Info
+		wantErr bool
+	}{
+		{name: "raw codestream", in: cs, want: JP2Info{FormatJ2K, 120, 160, 3}},
+		{name: "JP2", in: jp2File(ftyp, jp2Box("jp2c", cs)), want: want},
+		{name: "codestream box to end of file", in: jp2File(ftyp, []byte{0, 0, 0, 0}, []byte("jp2c"), cs), want: want},
+		{name: "XL boxes", in: jp2File(jp2XLBox("ftyp", uint64(16+len(ftypData)), ftypData), jp2XLBox("jp2c", uint64(16+len(cs)), cs)), want: want},
+		// The XL length wraps the end offset back onto the 16-byte box
+		// before it, which used to loop forever.
+		{name: "XL box length wraps", in: jp2File(ftyp, jp2Box("free", make([]byte, 8)), jp2XLBox("free", 1<<64-16, nil), jp2Box("jp2c", cs)), wantErr: true},
+		{name: "XL box past end of file", in: jp2File(ftyp, jp2XLBox("jp2c", 1<<40, cs)), wantErr: true},
+		{name: "truncated XL box", in: jp2File(ftyp, []byte{0, 0, 0, 1, 'j', 'p', '2', 'c', 0}), wantErr: true},
+		{name: "box shorter than its header", in: jp2File(ftyp, []byte{0, 0, 0, 4, 'j', 'p', '2', 'c'}), wantErr: true},
+		{name: "no codestream box", in: jp2File(ftyp), wantErr: true},
+		{name: "empty image area", in: j2kHeader(0, 160, 3), wantErr: true},
+		{name: "not JPEG2000", in: []byte("\x89PNG\r\n\x1a\n"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseJP2Header(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *info != tt.want {
+				t.Errorf("got %+v, want %+v", *info, tt.want)
+			}
+		})
+	}
+}
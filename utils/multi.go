@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// maxQRCodes caps how many codes the native decoders return per image.
+const maxQRCodes = 32
+
+// MultiDecoder is implemented by decoders that can return every QR code
+// in an image rather than the first one they find.
+type MultiDecoder interface {
+	Decoder
+	DecodeAll(img image.Image) ([]*DecodeResult, error)
+}
+
+// multiDecoderFunc is a decoderFunc that can also decode every code.
+type multiDecoderFunc struct {
+	decoderFunc
+	all func(image.Image) ([]*DecodeResult, error)
+}
+
+func (d multiDecoderFunc) DecodeAll(img image.Image) ([]*DecodeResult, error) {
+	results, err := d.all(img)
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range results {
+		if res.Decoder == "" {
+			res.Decoder = d.name
+		}
+	}
+	return results, nil
+}
+
+// NewMultiDecoderFunc wraps a single-code and an all-codes decode function
+// as a named MultiDecoder.
+func NewMultiDecoderFunc(name string, fn func(image.Image) ([]byte, error), all func(image.Image) ([]*DecodeResult, error)) Decoder {
+	return multiDecoderFunc{decoderFunc{name: name, fn: fn}, all}
+}
+
+// DecodeAll returns every QR code any enabled decoder finds in img,
+// deduplicated by payload and ordered top to bottom, left to right. No
+// Detector is involved.
+// Decoders without DecodeAll contribute their one payload, without a
+// polygon. The preprocessed variants are only tried while nothing has
+// been found; they keep the input geometry, so polygons stay in img's
+// coordinates. Images larger than opts.MaxSide are downscaled first and
+// their polygons mapped back.
+func (r *DecoderRegistry) DecodeAll(ctx context.Context, img image.Image, pre []Preprocessor, opts SearchOptions) ([]*DecodeResult, error) {
+	decoders := r.Decoders()
+	if len(decoders) == 0 {
+		return nil, fmt.Errorf("no QR decoders enabled")
+	}
+
+	b := img.Bounds()
+	scale := 1.0
+	if long := max(b.Dx(), b.Dy()); opts.MaxSide > 0 && long > opts.MaxSide {
+		scale = float64(opts.MaxSide) / float64(long)
+		log.Printf("[multi] Downscaling %dx%d by %.2f\n", b.Dx(), b.Dy(), scale)
+		img = Resize(toGray(img), scale)
+	}
+
+	variants := append([]Preprocessor{{Name: OriginalVariant}}, pre...)
+	var gray *image.Gray
+	var errs []string
+	for _, p := range variants {
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		src := img
+		if p.Apply != nil {
+			if gray == nil {
+				gray = toGray(img)
+			}
+			log.Printf("[preprocess] Trying variant %s\n", p.Name)
+			src = p.Apply(gray)
+		}
+
+		found, err := decodeAllWith(ctx, decoders, src)
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		if len(found) == 0 {
+			errs = append(errs, fmt.Sprintf("%s: %v", p.Name, err))
+			continue
+		}
+		for _, res := range found {
+			res.Variant = p.Name
+			for i, pt := range res.Polygon {
+				res.Polygon[i] = Point{pt.X/scale + float64(b.Min.X), pt.Y/scale + float64(b.Min.Y)}
+			}
+		}
+		sortByPosition(found)
+		log.Printf("[multi] %d code(s) found on variant %s\n", len(found), p.Name)
+		return found, nil
+	}
+	return nil, fmt.Errorf("no variant decoded: %s", strings.Join(errs, " | "))
+}
+
+// decodeAllWith runs every decoder on img and merges their codes. A code
+// seen by several decoders is kept once, under the first decoder's name,
+// taking its polygon from whichever decoder reported one.
+func decodeAllWith(ctx context.Context, decoders []Decoder, img image.Image) ([]*DecodeResult, error) {
+	var found []*DecodeResult
+	seen := make(map[string]*DecodeResult)
+	var errs []string
+	for _, d := range decoders {
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		log.Printf("[multi] Attempting %s decode...\n", d.Name())
+		var results []*DecodeResult
+		var err error
+		if md, ok := d.(MultiDecoder); ok {
+			results, err = decodeAllContext(ctx, md, img)
+		} else {
+			var res *DecodeResult
+			if res, err = decodeWith(ctx, d, img); err == nil && res != nil {
+				results = []*DecodeResult{res}
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", d.Name(), err))
+			continue
+		}
+
+		for _, res := range results {
+			if len(res.Payload) == 0 {
+				continue
+			}
+			if res.Decoder == "" {
+				res.Decoder = d.Name()
+			}
+			if prev, ok := seen[string(res.Payload)]; ok {
+				if len(prev.Polygon) == 0 {
+					prev.Polygon = res.Polygon
+				}
+				continue
+			}
+			seen[string(res.Payload)] = res
+			found = append(found, res)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("all decoders failed (%s)", strings.Join(errs, "; "))
+	}
+	return found, nil
+}
+
+// decodeAllContext is decoderFunc.DecodeContext for DecodeAll.
+func decodeAllContext(ctx context.Context, d MultiDecoder, img image.Image) ([]*DecodeResult, error) {
+	if ctx.Done() == nil {
+		return d.DecodeAll(img)
+	}
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	type result struct {
+		results []*DecodeResult
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		results, err := d.DecodeAll(img)
+		done <- result{results, err}
+	}()
+	select {
+	case r := <-done:
+		return r.results, r.err
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// sortByPosition orders codes in reading order: codes whose centres are
+// within half a code height of each other share a row. Codes without a
+// polygon go last, in the order they were found.
+func sortByPosition(results []*DecodeResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i].Polygon, results[j].Polygon
+		if len(a) == 0 || len(b) == 0 {
+			return len(a) > 0 && len(b) == 0
+		}
+		ca, ha := polygonCentre(a)
+		cb, hb := polygonCentre(b)
+		if math.Abs(ca.Y-cb.Y) > min(ha, hb)/2 {
+			return ca.Y < cb.Y
+		}
+		return ca.X < cb.X
+	})
+}
+
+// polygonCentre returns the mean of the points and the polygon's height.
+func polygonCentre(poly []Point) (Point, float64) {
+	var c Point
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, p := range poly {
+		c.X += p.X
+		c.Y += p.Y
+		minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+	}
+	n := float64(len(poly))
+	return Point{c.X / n, c.Y / n}, maxY - minY
+}
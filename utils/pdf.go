@@ -0,0 +1,951 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// minPDFImageSide skips logos, bullets and other images too small to hold
+// even a version 1 QR code.
+const minPDFImageSide = 21
+
+// Limits on untrusted PDF input. An image may have at most
+// maxPDFImagePixels pixels, and arrays, dictionaries and color spaces may
+// only nest so deep.
+const (
+	maxPDFImagePixels   = 1 << 25
+	maxPDFNesting       = 256
+	maxPDFColorSpaceRef = 8
+)
+
+// maxPDFStreamSize bounds a decompressed stream: enough for
+// maxPDFImagePixels 16-bit CMYK pixels.
+var maxPDFStreamSize = 1 << 28
+
+var (
+	// ErrPDFPasswordRequired is returned for encrypted PDFs that do not
+	// open with the empty user password.
+	ErrPDFPasswordRequired = errors.New("PDF is password protected")
+	// ErrPDFBadPassword is returned when the supplied password matches
+	// neither the user nor the owner password.
+	ErrPDFBadPassword = errors.New("incorrect PDF password")
+	// ErrPDFNoImages is returned when a PDF has no usable raster images and
+	// no page renderer is configured.
+	ErrPDFNoImages = errors.New("no images found in PDF")
+)
+
+// PDF object model. Only what is needed to find image XObjects is
+// supported: no content streams, fonts or cross-reference tables; objects
+// are located by scanning for "N G obj" headers.
+type (
+	pdfName   string
+	pdfString []byte
+	pdfArray  []interface{}
+	pdfDict   map[pdfName]interface{}
+	pdfRef    struct{ num, gen int }
+)
+
+type pdfStream struct {
+	ref  pdfRef
+	dict pdfDict
+	data []byte
+}
+
+type pdfDoc struct {
+	objects map[pdfRef]interface{}
+	streams []*pdfStream
+	trailer pdfDict
+	crypt   *pdfCrypt
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// ExtractPDFImages returns the raster images embedded in a PDF, largest
+// first. password is tried as both user and owner password of an
+// encrypted document.
+func ExtractPDFImages(b []byte, password string) ([]image.Image, error) {
+	doc, err := parsePDF(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.setupEncryption(password); err != nil {
+		return nil, err
+	}
+	doc.expandObjectStreams()
+
+	smasks := make(map[pdfRef]bool)
+	for _, s := range doc.streams {
+		if ref, ok := s.dict["SMask"].(pdfRef); ok {
+			smasks[ref] = true
+		}
+	}
+
+	var images []image.Image
+	for _, s := range doc.streams {
+		if doc.name(s.dict["Subtype"]) != "Image" || smasks[s.ref] {
+			continue
+		}
+		w, h := doc.int(s.dict["Width"]), doc.int(s.dict["Height"])
+		if w < minPDFImageSide || h < minPDFImageSide {
+			continue
+		}
+		img, err := doc.decodeImage(s)
+		if err != nil {
+			log.Printf("[pdf] Skipping image %d %d R (%dx%d): %v\n", s.ref.num, s.ref.gen, w, h, err)
+			continue
+		}
+		images = append(images, img)
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		bi, bj := images[i].Bounds(), images[j].Bounds()
+		return bi.Dx()*bi.Dy() > bj.Dx()*bj.Dy()
+	})
+	log.Printf("[pdf] Extracted %d image(s)\n", len(images))
+	return images, nil
+}
+
+func parsePDF(b []byte) (*pdfDoc, error) {
+	if !bytes.HasPrefix(b, []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	doc := &pdfDoc{objects: make(map[pdfRef]interface{}), trailer: pdfDict{}}
+
+	// Streams whose /Length is an indirect reference are bounded by the
+	// "endstream" keyword until all objects are known.
+	type pendingLength struct {
+		s     *pdfStream
+		start int
+		ref   pdfRef
+	}
+	var pending []pendingLength
+
+	pos := 0
+	for {
+		loc := pdfObjHeader.FindSubmatchIndex(b[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(b[pos+loc[2] : pos+loc[3]]))
+		gen, _ := strconv.Atoi(string(b[pos+loc[4] : pos+loc[5]]))
+		ref := pdfRef{num, gen}
+
+		p := &pdfParser{b: b, pos: pos + loc[1]}
+		obj, err := p.object()
+		if err != nil {
+			pos += loc[1]
+			continue
+		}
+		pos = p.pos
+
+		dict, isDict := obj.(pdfDict)
+		p.skipSpace()
+		if !isDict || !p.keyword("stream") {
+			doc.objects[ref] = obj
+			continue
+		}
+
+		// The keyword is followed by CRLF or LF before the data.
+		start := p.pos
+		if start < len(b) && b[start] == '\r' {
+			start++
+		}
+		if start < len(b) && b[start] == '\n' {
+			start++
+		}
+		s := &pdfStream{ref: ref, dict: dict}
+		end := -1
+		if n, ok := dict["Length"].(int); ok && n >= 0 && start+n <= len(b) {
+			if bytes.HasPrefix(bytes.TrimLeft(b[start+n:], "\r\n \t"), []byte("endstream")) {
+				end = start + n
+			}
+		}
+		if end < 0 {
+			i := bytes.Index(b[start:], []byte("endstream"))
+			if i < 0 {
+				break
+			}
+			end = start + i
+			if lref, ok := dict["Length"].(pdfRef); ok {
+				pending = append(pending, pendingLength{s, start, lref})
+			}
+		}
+		s.data = b[start:end]
+		doc.objects[ref] = s
+		doc.streams = append(doc.streams, s)
+		pos = end
+
+		if doc.name(dict["Type"]) == "XRef" {
+			doc.mergeTrailer(dict)
+		}
+	}
+
+	for _, pl := range pending {
+		if n, ok := doc.resolve(pl.ref).(int); ok && n >= 0 && pl.start+n <= len(b) && n <= len(pl.s.data) {
+			pl.s.data = b[pl.start : pl.start+n]
+		}
+	}
+
+	// Classic trailers; later ones (incremental updates) win.
+	for off := 0; ; {
+		i := bytes.Index(b[off:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		p := &pdfParser{b: b, pos: off + i + len("trailer")}
+		if obj, err := p.object(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				doc.mergeTrailer(dict)
+			}
+		}
+		off += i + len("trailer")
+	}
+
+	if len(doc.objects) == 0 {
+		return nil, fmt.Errorf("no PDF objects found")
+	}
+	return doc, nil
+}
+
+func (d *pdfDoc) mergeTrailer(dict pdfDict) {
+	for _, k := range []pdfName{"Encrypt", "ID", "Root"} {
+		if v, ok := dict[k]; ok {
+			d.trailer[k] = v
+		}
+	}
+}
+
+// expandObjectStreams adds the objects packed into /Type /ObjStm streams
+// (PDF 1.5+), without overriding objects defined directly in the file.
+func (d *pdfDoc) expandObjectStreams() {
+	for _, s := range d.streams {
+		if d.name(s.dict["Type"]) != "ObjStm" {
+			continue
+		}
+		data, err := d.streamData(s)
+		if err != nil {
+			log.Printf("[pdf] Object stream %d: %v\n", s.ref.num, err)
+			continue
+		}
+		n, first := d.int(s.dict["N"]), d.int(s.dict["First"])
+		if first > len(data) {
+			continue
+		}
+		hp := &pdfParser{b: data[:first]}
+		for i := 0; i < n; i++ {
+			num, err1 := hp.object()
+			off, err2 := hp.object()
+			if err1 != nil || err2 != nil {
+				break
+			}
+			objNum, ok1 := num.(int)
+			objOff, ok2 := off.(int)
+			if !ok1 || !ok2 || first+objOff >= len(data) {
+				continue
+			}
+			ref := pdfRef{objNum, 0}
+			if _, exists := d.objects[ref]; exists {
+				continue
+			}
+			p := &pdfParser{b: data, pos: first + objOff}
+			if obj, err := p.object(); err == nil {
+				d.objects[ref] = obj
+			}
+		}
+	}
+}
+
+func (d *pdfDoc) resolve(v interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.objects[ref]
+	}
+	return nil
+}
+
+// resolveOwner is resolve that also returns the last object reference
+// followed, or owner if v was a direct object. Strings are encrypted with
+// the key of the object they belong to.
+func (d *pdfDoc) resolveOwner(v interface{}, owner pdfRef) (interface{}, pdfRef) {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v, owner
+		}
+		v, owner = d.objects[ref], ref
+	}
+	return nil, owner
+}
+
+func (d *pdfDoc) name(v interface{}) pdfName {
+	n, _ := d.resolve(v).(pdfName)
+	return n
+}
+
+func (d *pdfDoc) int(v interface{}) int {
+	switch n := d.resolve(v).(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// streamData decrypts and runs the non-image filters of a stream,
+// stopping before DCTDecode or JPXDecode.
+func (d *pdfDoc) streamData(s *pdfStream) ([]byte, error) {
+	data, _, err := d.decodeStream(s)
+	return data, err
+}
+
+// decodeStream returns the stream contents after all general-purpose
+// filters, plus the image codec filter left to apply, if any.
+func (d *pdfDoc) decodeStream(s *pdfStream) ([]byte, pdfName, error) {
+	data := s.data
+	if d.crypt != nil && d.name(s.dict["Type"]) != "XRef" {
+		var err error
+		if data, err = d.crypt.decryptStream(s.ref, s.dict, data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var filters []pdfName
+	var params []pdfDict
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []pdfName{f}
+	case pdfArray:
+		for _, v := range f {
+			filters = append(filters, d.name(v))
+		}
+	}
+	switch p := d.resolve(s.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = []pdfDict{p}
+	case pdfArray:
+		for _, v := range p {
+			dict, _ := d.resolve(v).(pdfDict)
+			params = append(params, dict)
+		}
+	}
+
+	for i, f := range filters {
+		var parms pdfDict
+		if i < len(params) {
+			parms = params[i]
+		}
+		var err error
+		switch f {
+		case "FlateDecode", "Fl":
+			data, err = d.inflate(data, parms)
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		case "Crypt":
+			// Decryption already happened above with the default filter.
+		case "DCTDecode", "DCT", "JPXDecode":
+			if i != len(filters)-1 {
+				return nil, "", fmt.Errorf("filter %s is not last", f)
+			}
+			return data, f, nil
+		default:
+			return nil, "", fmt.Errorf("unsupported filter %s", f)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %v", f, err)
+		}
+	}
+	return data, "", nil
+}
+
+func (d *pdfDoc) inflate(data []byte, parms pdfDict) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	out, err := io.ReadAll(io.LimitReader(zr, int64(maxPDFStreamSize)+1))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	if len(out) > maxPDFStreamSize {
+		return nil, fmt.Errorf("stream inflates to more than %d bytes", maxPDFStreamSize)
+	}
+	// Truncated deflate data is common in the wild; keep what decoded.
+
+	predictor := d.int(parms["Predictor"])
+	if predictor < 10 {
+		if predictor == 2 {
+			return nil, fmt.Errorf("TIFF predictor not supported")
+		}
+		return out, nil
+	}
+	colors, bpc, columns := 1, 8, 1
+	if v, ok := parms["Colors"]; ok {
+		colors = d.int(v)
+	}
+	if v, ok := parms["BitsPerComponent"]; ok {
+		bpc = d.int(v)
+	}
+	if v, ok := parms["Columns"]; ok {
+		columns = d.int(v)
+	}
+	return unpredictPNG(out, colors, bpc, columns)
+}
+
+// unpredictPNG reverses the per-row PNG filters used by the Flate
+// predictors 10-15.
+func unpredictPNG(data []byte, colors, bpc, columns int) ([]byte, error) {
+	rowLen := (columns*colors*bpc + 7) / 8
+	bpp := max(1, colors*bpc/8)
+	if rowLen <= 0 {
+		return nil, fmt.Errorf("bad predictor parameters")
+	}
+	rows := len(data) / (rowLen + 1)
+	out := make([]byte, rows*rowLen)
+	prev := make([]byte, rowLen)
+	for r := 0; r < rows; r++ {
+		in := data[r*(rowLen+1):]
+		ft, row := in[0], out[r*rowLen:(r+1)*rowLen]
+		copy(row, in[1:rowLen+1])
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch ft {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var clean []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if isPDFSpace(c) {
+			continue
+		}
+		clean = append(clean, c)
+	}
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	out := make([]byte, len(clean)/2)
+	_, err := hex.Decode(out, clean)
+	return out, err
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// decodeImage turns an image XObject into an image.Image.
+func (d *pdfDoc) decodeImage(s *pdfStream) (image.Image, error) {
+	data, codec, err := d.decodeStream(s)
+	if err != nil {
+		return nil, err
+	}
+	// Embedded JPEG and JPEG2000 images are checked against the pixel
+	// limit by their own headers before any pixels are decoded.
+	switch codec {
+	case "DCTDecode", "DCT":
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPDFImageSize(cfg.Width, cfg.Height); err != nil {
+			return nil, err
+		}
+		// PDF viewers ignore EXIF orientation, so decode without it.
+		return jpeg.Decode(bytes.NewReader(data))
+	case "JPXDecode":
+		info, err := ParseJP2Header(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPDFImageSize(info.Width, info.Height); err != nil {
+			return nil, err
+		}
+		return DecodeJPEG2000(data)
+	}
+
+	w, h := d.int(s.dict["Width"]), d.int(s.dict["Height"])
+	bpc := d.int(s.dict["BitsPerComponent"])
+	imageMask := d.resolve(s.dict["ImageMask"]) == true
+	if imageMask {
+		bpc = 1
+	}
+	if bpc != 1 && bpc != 2 && bpc != 4 && bpc != 8 && bpc != 16 {
+		return nil, fmt.Errorf("unsupported BitsPerComponent %d", bpc)
+	}
+	if err := checkPDFImageSize(w, h); err != nil {
+		return nil, err
+	}
+
+	comps, palette, invert, err := d.colorSpace(s.dict["ColorSpace"], s.ref, 0)
+	if err != nil && !imageMask {
+		return nil, err
+	}
+	if imageMask {
+		comps, palette, invert = 1, nil, false
+	}
+	if dec, ok := d.resolve(s.dict["Decode"]).(pdfArray); ok && len(dec) >= 2 && palette == nil {
+		if lo, hi := d.number(dec[0]), d.number(dec[1]); lo > hi {
+			invert = !invert
+		}
+	}
+
+	// w*h is bounded above, so this cannot overflow a uint64.
+	rowLen := (uint64(w)*uint64(comps)*uint64(bpc) + 7) / 8
+	if need := rowLen * uint64(h); uint64(len(data)) < need {
+		return nil, fmt.Errorf("image data too short: %d < %d", len(data), need)
+	}
+	maxVal := (1 << bpc) - 1
+	sample := func(row []byte, i int) int {
+		switch bpc {
+		case 8:
+			return int(row[i])
+		case 16:
+			return int(row[2*i])<<8 | int(row[2*i+1])
+		}
+		bit := i * bpc
+		return int(row[bit/8]>>(8-bpc-bit%8)) & maxVal
+	}
+	scale := func(v int) uint8 { return uint8(v * 255 / maxVal) }
+
+	rect := image.Rect(0, 0, w, h)
+	switch {
+	case palette != nil:
+		img := image.NewRGBA(rect)
+		for y := 0; y < h; y++ {
+			row := data[uint64(y)*rowLen:]
+			for x := 0; x < w; x++ {
+				if i := sample(row, x); i < len(palette) {
+					img.Set(x, y, palette[i])
+				}
+			}
+		}
+		return img, nil
+	case comps == 1:
+		img := image.NewGray(rect)
+		for y := 0; y < h; y++ {
+			row := data[uint64(y)*rowLen:]
+			for x := 0; x < w; x++ {
+				v := scale(sample(row, x))
+				if invert {
+					v = 0xFF - v
+				}
+				img.Pix[y*img.Stride+x] = v
+			}
+		}
+		return img, nil
+	case comps == 3:
+		img := image.NewRGBA(rect)
+		for y := 0; y < h; y++ {
+			row := data[uint64(y)*rowLen:]
+			for x := 0; x < w; x++ {
+				img.Set(x, y, color.RGBA{scale(sample(row, 3*x)), scale(sample(row, 3*x+1)), scale(sample(row, 3*x+2)), 0xFF})
+			}
+		}
+		return img, nil
+	case comps == 4:
+		img := image.NewCMYK(rect)
+		for y := 0; y < h; y++ {
+			row := data[uint64(y)*rowLen:]
+			for x := 0; x < w; x++ {
+				img.Set(x, y, color.CMYK{scale(sample(row, 4*x)), scale(sample(row, 4*x+1)), scale(sample(row, 4*x+2)), scale(sample(row, 4*x+3))})
+			}
+		}
+		return img, nil
+	}
+	return nil, fmt.Errorf("unsupported number of color components %d", comps)
+}
+
+func checkPDFImageSize(w, h int) error {
+	if w <= 0 || h <= 0 || uint64(w)*uint64(h) > maxPDFImagePixels {
+		return fmt.Errorf("image size %dx%d out of range", w, h)
+	}
+	return nil
+}
+
+func (d *pdfDoc) number(v interface{}) float64 {
+	switch n := d.resolve(v).(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// colorSpace returns the number of components per sample, the palette of
+// an Indexed space, and whether sample values run dark-to-light reversed
+// (Separation tints). owner is the object v appears in, whose key decrypts
+// an inline lookup string; depth counts nested color spaces so a space
+// that refers to itself cannot recurse forever.
+func (d *pdfDoc) colorSpace(v interface{}, owner pdfRef, depth int) (int, color.Palette, bool, error) {
+	if depth > maxPDFColorSpaceRef {
+		return 0, nil, false, fmt.Errorf("color space nested too deeply")
+	}
+	v, owner = d.resolveOwner(v, owner)
+	switch cs := v.(type) {
+	case pdfName:
+		switch cs {
+		case "DeviceGray", "CalGray", "G":
+			return 1, nil, false, nil
+		case "DeviceRGB", "CalRGB", "RGB":
+			return 3, nil, false, nil
+		case "DeviceCMYK", "CMYK":
+			return 4, nil, false, nil
+		}
+		return 0, nil, false, fmt.Errorf("unsupported color space %s", cs)
+	case pdfArray:
+		if len(cs) == 0 {
+			break
+		}
+		switch d.name(cs[0]) {
+		case "ICCBased":
+			if len(cs) > 1 {
+				if s, ok := d.resolve(cs[1]).(*pdfStream); ok {
+					if n := d.int(s.dict["N"]); n == 1 || n == 3 || n == 4 {
+						return n, nil, false, nil
+					}
+				}
+			}
+		case "CalGray", "CalRGB", "Lab":
+			return d.colorSpace(cs[0], owner, depth+1)
+		case "Separation", "DeviceN":
+			return 1, nil, true, nil
+		case "Indexed", "I":
+			if len(cs) < 4 {
+				break
+			}
+			base, _, _, err := d.colorSpace(cs[1], owner, depth+1)
+			if err != nil {
+				return 0, nil, false, err
+			}
+			var lookup []byte
+			l, lowner := d.resolveOwner(cs[3], owner)
+			switch l := l.(type) {
+			case pdfString:
+				lookup = l
+				if d.crypt != nil {
+					if lookup, err = d.crypt.decryptString(lowner, l); err != nil {
+						return 0, nil, false, err
+					}
+				}
+			case *pdfStream:
+				if lookup, err = d.streamData(l); err != nil {
+					return 0, nil, false, err
+				}
+			}
+			// hival comes from the file: a palette has 1 to 256 entries
+			// and no more than the lookup table holds.
+			n := min(max(d.int(cs[2])+1, 1), 256, len(lookup)/base)
+			palette := make(color.Palette, 0, n)
+			for i := 0; i < n && (i+1)*base <= len(lookup); i++ {
+				c := lookup[i*base:]
+				switch base {
+				case 1:
+					palette = append(palette, color.Gray{c[0]})
+				case 3:
+					palette = append(palette, color.RGBA{c[0], c[1], c[2], 0xFF})
+				case 4:
+					palette = append(palette, color.CMYK{c[0], c[1], c[2], c[3]})
+				}
+			}
+			return 1, palette, false, nil
+		}
+	case nil:
+		return 0, nil, false, fmt.Errorf("missing color space")
+	}
+	return 0, nil, false, fmt.Errorf("unsupported color space %v", v)
+}
+
+// pdfParser reads PDF objects from b starting at pos.
+type pdfParser struct {
+	b   []byte
+	pos int
+	// depth is the number of arrays and dictionaries being parsed.
+	depth int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		if c == '%' {
+			for p.pos < len(p.b) && p.b[p.pos] != '\n' && p.b[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+// keyword consumes kw if it is the next token.
+func (p *pdfParser) keyword(kw string) bool {
+	end := p.pos + len(kw)
+	if end > len(p.b) || string(p.b[p.pos:end]) != kw {
+		return false
+	}
+	if end < len(p.b) && !isPDFSpace(p.b[end]) && !isPDFDelim(p.b[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *pdfParser) object() (interface{}, error) {
+	if p.depth > maxPDFNesting {
+		return nil, fmt.Errorf("objects nested too deeply at offset %d", p.pos)
+	}
+	p.skipSpace()
+	if p.pos >= len(p.b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch c := p.b[p.pos]; {
+	case c == '/':
+		return p.name(), nil
+	case c == '<' && p.pos+1 < len(p.b) && p.b[p.pos+1] == '<':
+		return p.dict()
+	case c == '<':
+		return p.hexString()
+	case c == '(':
+		return p.literalString()
+	case c == '[':
+		return p.array()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.numberOrRef()
+	case p.keyword("true"):
+		return true, nil
+	case p.keyword("false"):
+		return false, nil
+	case p.keyword("null"):
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", p.b[p.pos], p.pos)
+}
+
+func (p *pdfParser) name() pdfName {
+	p.pos++ // '/'
+	var out []byte
+	for p.pos < len(p.b) && !isPDFSpace(p.b[p.pos]) && !isPDFDelim(p.b[p.pos]) {
+		c := p.b[p.pos]
+		if c == '#' && p.pos+2 < len(p.b) {
+			if v, err := strconv.ParseUint(string(p.b[p.pos+1:p.pos+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				p.pos += 3
+				continue
+			}
+		}
+		out = append(out, c)
+		p.pos++
+	}
+	return pdfName(out)
+}
+
+func (p *pdfParser) dict() (pdfDict, error) {
+	p.pos += 2 // "<<"
+	p.depth++
+	defer func() { p.depth-- }()
+	dict := pdfDict{}
+	for {
+		p.skipSpace()
+		if p.pos+1 < len(p.b) && p.b[p.pos] == '>' && p.b[p.pos+1] == '>' {
+			p.pos += 2
+			return dict, nil
+		}
+		if p.pos >= len(p.b) || p.b[p.pos] != '/' {
+			return nil, fmt.Errorf("expected name key at offset %d", p.pos)
+		}
+		key := p.name()
+		val, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		dict[key] = val
+	}
+}
+
+func (p *pdfParser) array() (pdfArray, error) {
+	p.pos++ // '['
+	p.depth++
+	defer func() { p.depth-- }()
+	var arr pdfArray
+	for {
+		p.skipSpace()
+		if p.pos < len(p.b) && p.b[p.pos] == ']' {
+			p.pos++
+			return arr, nil
+		}
+		val, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, val)
+	}
+}
+
+func (p *pdfParser) hexString() (pdfString, error) {
+	p.pos++ // '<'
+	end := bytes.IndexByte(p.b[p.pos:], '>')
+	if end < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	out, err := asciiHexDecode(p.b[p.pos : p.pos+end])
+	p.pos += end + 1
+	return pdfString(out), err
+}
+
+func (p *pdfParser) literalString() (pdfString, error) {
+	p.pos++ // '('
+	var out []byte
+	depth := 1
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(out), nil
+			}
+		case '\\':
+			if p.pos >= len(p.b) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			e := p.b[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.b) && p.b[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.b) && p.b[p.pos] >= '0' && p.b[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.b[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+func (p *pdfParser) numberOrRef() (interface{}, error) {
+	tok := p.token()
+	if i, err := strconv.Atoi(tok); err == nil {
+		// "N G R" is an indirect reference.
+		save := p.pos
+		p.skipSpace()
+		if gen, err := strconv.Atoi(p.token()); err == nil && i >= 0 && gen >= 0 {
+			p.skipSpace()
+			if p.keyword("R") {
+				return pdfRef{i, gen}, nil
+			}
+		}
+		p.pos = save
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad number %q", tok)
+	}
+	return f, nil
+}
+
+func (p *pdfParser) token() string {
+	start := p.pos
+	for p.pos < len(p.b) && !isPDFSpace(p.b[p.pos]) && !isPDFDelim(p.b[p.pos]) {
+		p.pos++
+	}
+	return string(p.b[start:p.pos])
+}
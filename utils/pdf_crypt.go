@@ -0,0 +1,435 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"log"
+)
+
+// pdfPasswordPad pads passwords for the RC4 and AES-128 revisions of the
+// standard security handler (PDF 32000-1, 7.6.3.3).
+var pdfPasswordPad = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+const (
+	pdfCryptNone  = "None"
+	pdfCryptRC4   = "V2"
+	pdfCryptAESV2 = "AESV2"
+	pdfCryptAESV3 = "AESV3"
+)
+
+// pdfCrypt decrypts streams and strings of a PDF protected by the
+// standard security handler: RC4 40-128 bit (R2-R4), AES-128 (R4) and
+// AES-256 (R5, R6). V4+ documents pick the stream and string methods
+// separately (StmF, StrF).
+type pdfCrypt struct {
+	key       []byte
+	method    string
+	strMethod string
+}
+
+// setupEncryption authenticates password against the document's Encrypt
+// dictionary, trying the empty password first.
+func (d *pdfDoc) setupEncryption(password string) error {
+	h, err := d.securityHandler()
+	if err != nil || h == nil {
+		return err
+	}
+	if key, ok := h.authenticate(""); ok {
+		log.Println("[pdf] Encrypted with empty user password")
+		d.crypt = &pdfCrypt{key: key, method: h.method, strMethod: h.strMethod}
+		return nil
+	}
+	if password == "" {
+		return ErrPDFPasswordRequired
+	}
+	key, ok := h.authenticate(password)
+	if !ok {
+		return ErrPDFBadPassword
+	}
+	log.Printf("[pdf] Password accepted (R%d, %s)\n", h.r, h.method)
+	d.crypt = &pdfCrypt{key: key, method: h.method, strMethod: h.strMethod}
+	return nil
+}
+
+// securityHandler reads the document's Encrypt dictionary; it returns nil
+// for unencrypted documents.
+func (d *pdfDoc) securityHandler() (*pdfSecurityHandler, error) {
+	encRef, ok := d.trailer["Encrypt"]
+	if !ok {
+		return nil, nil
+	}
+	enc, ok := d.resolve(encRef).(pdfDict)
+	if !ok {
+		return nil, fmt.Errorf("PDF: unreadable Encrypt dictionary")
+	}
+	if f := d.name(enc["Filter"]); f != "Standard" {
+		return nil, fmt.Errorf("PDF: unsupported security handler %s", f)
+	}
+
+	var id0 []byte
+	if ids, ok := d.resolve(d.trailer["ID"]).(pdfArray); ok && len(ids) > 0 {
+		id0, _ = d.resolve(ids[0]).(pdfString)
+	}
+	return newPDFSecurityHandler(d, enc, id0)
+}
+
+// pdfOwnerPasswordOnly reports whether password opens the encrypted PDF b
+// as its owner but not as a user.
+func pdfOwnerPasswordOnly(b []byte, password string) bool {
+	doc, err := parsePDF(b)
+	if err != nil {
+		return false
+	}
+	h, err := doc.securityHandler()
+	if err != nil || h == nil {
+		return false
+	}
+	if _, ok := h.authenticateUser(password); ok {
+		return false
+	}
+	_, ok := h.authenticateOwner(password)
+	return ok
+}
+
+type pdfSecurityHandler struct {
+	v, r            int
+	keyLen          int
+	o, u, oe, ue    []byte
+	p               uint32
+	id0             []byte
+	encryptMetadata bool
+	method          string
+	strMethod       string
+}
+
+func newPDFSecurityHandler(d *pdfDoc, enc pdfDict, id0 []byte) (*pdfSecurityHandler, error) {
+	h := &pdfSecurityHandler{
+		v:               d.int(enc["V"]),
+		r:               d.int(enc["R"]),
+		keyLen:          5,
+		p:               uint32(int32(d.int(enc["P"]))),
+		id0:             id0,
+		encryptMetadata: d.resolve(enc["EncryptMetadata"]) != false,
+		method:          pdfCryptRC4,
+		strMethod:       pdfCryptRC4,
+	}
+	h.o, _ = d.resolve(enc["O"]).(pdfString)
+	h.u, _ = d.resolve(enc["U"]).(pdfString)
+	h.oe, _ = d.resolve(enc["OE"]).(pdfString)
+	h.ue, _ = d.resolve(enc["UE"]).(pdfString)
+	if bits := d.int(enc["Length"]); bits >= 40 && bits <= 128 && bits%8 == 0 {
+		h.keyLen = bits / 8
+	}
+
+	switch h.v {
+	case 1, 2:
+	case 4, 5:
+		var err error
+		if h.method, err = cryptFilterMethod(d, enc, "StmF"); err != nil {
+			return nil, err
+		}
+		if h.strMethod, err = cryptFilterMethod(d, enc, "StrF"); err != nil {
+			return nil, err
+		}
+		for _, m := range []string{h.method, h.strMethod} {
+			switch m {
+			case pdfCryptAESV2:
+				h.keyLen = 16
+			case pdfCryptAESV3:
+				h.keyLen = 32
+			}
+		}
+	default:
+		return nil, fmt.Errorf("PDF: unsupported encryption version V%d", h.v)
+	}
+
+	// The MD5 key derivation of R2-R4 yields at most 16 bytes.
+	if h.r < 5 {
+		if h.method == pdfCryptAESV3 || h.strMethod == pdfCryptAESV3 {
+			return nil, fmt.Errorf("PDF: AESV3 crypt filter needs R5 or later, not R%d", h.r)
+		}
+		h.keyLen = min(h.keyLen, 16)
+	}
+
+	if h.r >= 5 {
+		if len(h.o) < 48 || len(h.u) < 48 || len(h.oe) < 32 || len(h.ue) < 32 {
+			return nil, fmt.Errorf("PDF: malformed R%d Encrypt dictionary", h.r)
+		}
+	} else if len(h.o) < 32 || len(h.u) < 32 {
+		return nil, fmt.Errorf("PDF: malformed R%d Encrypt dictionary", h.r)
+	}
+	return h, nil
+}
+
+// cryptFilterMethod returns the CFM of the crypt filter enc[key] names,
+// or None for the Identity filter.
+func cryptFilterMethod(d *pdfDoc, enc pdfDict, key pdfName) (string, error) {
+	name := d.name(enc[key])
+	if name == "" || name == "Identity" {
+		return pdfCryptNone, nil
+	}
+	cf, _ := d.resolve(enc["CF"]).(pdfDict)
+	filter, _ := d.resolve(cf[name]).(pdfDict)
+	if filter == nil {
+		return "", fmt.Errorf("PDF: crypt filter %s not defined", name)
+	}
+	switch m := string(d.name(filter["CFM"])); m {
+	case pdfCryptNone, pdfCryptRC4, pdfCryptAESV2, pdfCryptAESV3:
+		return m, nil
+	default:
+		return "", fmt.Errorf("PDF: unsupported crypt filter method %s", m)
+	}
+}
+
+// authenticate returns the file key if password is the user or the owner
+// password.
+func (h *pdfSecurityHandler) authenticate(password string) ([]byte, bool) {
+	if key, ok := h.authenticateUser(password); ok {
+		return key, true
+	}
+	return h.authenticateOwner(password)
+}
+
+// authenticateUser returns the file key if password is the user password
+// (Algorithms 6 and 2.A).
+func (h *pdfSecurityHandler) authenticateUser(password string) ([]byte, bool) {
+	pw := []byte(password)
+	if h.r >= 5 {
+		pw = pw[:min(len(pw), 127)]
+		if bytes.Equal(h.hashAES256(pw, h.u[32:40], nil), h.u[:32]) {
+			return aesCBCDecryptNoPad(h.hashAES256(pw, h.u[40:48], nil), h.ue[:32]), true
+		}
+		return nil, false
+	}
+	if key := h.fileKey(pw); h.checkUserKey(key) {
+		return key, true
+	}
+	return nil, false
+}
+
+// authenticateOwner returns the file key if password is the owner
+// password (Algorithms 7 and 2.A).
+func (h *pdfSecurityHandler) authenticateOwner(password string) ([]byte, bool) {
+	pw := []byte(password)
+	if h.r >= 5 {
+		pw = pw[:min(len(pw), 127)]
+		if bytes.Equal(h.hashAES256(pw, h.o[32:40], h.u[:48]), h.o[:32]) {
+			return aesCBCDecryptNoPad(h.hashAES256(pw, h.o[40:48], h.u[:48]), h.oe[:32]), true
+		}
+		return nil, false
+	}
+	// The owner password decrypts O into the user password.
+	user := h.ownerToUser(pw)
+	if key := h.fileKey(user); h.checkUserKey(key) {
+		return key, true
+	}
+	return nil, false
+}
+
+func padPDFPassword(pw []byte) []byte {
+	out := make([]byte, 0, 32)
+	out = append(out, pw[:min(len(pw), 32)]...)
+	return append(out, pdfPasswordPad[:32-len(out)]...)
+}
+
+// fileKey is Algorithm 2 of the standard security handler.
+func (h *pdfSecurityHandler) fileKey(pw []byte) []byte {
+	m := md5.New()
+	m.Write(padPDFPassword(pw))
+	m.Write(h.o[:32])
+	var p [4]byte
+	binary.LittleEndian.PutUint32(p[:], h.p)
+	m.Write(p[:])
+	m.Write(h.id0)
+	if h.r >= 4 && !h.encryptMetadata {
+		m.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	sum := m.Sum(nil)
+	n := h.keyLen
+	if h.r == 2 {
+		n = 5
+	}
+	if h.r >= 3 {
+		for i := 0; i < 50; i++ {
+			s := md5.Sum(sum[:n])
+			sum = s[:]
+		}
+	}
+	return sum[:n]
+}
+
+// checkUserKey recomputes the U entry from key (Algorithms 4 and 5).
+func (h *pdfSecurityHandler) checkUserKey(key []byte) bool {
+	if h.r == 2 {
+		return bytes.Equal(rc4Crypt(key, pdfPasswordPad), h.u[:32])
+	}
+	m := md5.New()
+	m.Write(pdfPasswordPad)
+	m.Write(h.id0)
+	x := rc4Crypt(key, m.Sum(nil))
+	for i := 1; i <= 19; i++ {
+		x = rc4Crypt(xorKey(key, byte(i)), x)
+	}
+	return bytes.Equal(x, h.u[:16])
+}
+
+// ownerToUser recovers the padded user password from O (Algorithm 7).
+func (h *pdfSecurityHandler) ownerToUser(pw []byte) []byte {
+	sum := md5.Sum(padPDFPassword(pw))
+	key := sum[:]
+	n := h.keyLen
+	if h.r == 2 {
+		n = 5
+	}
+	if h.r >= 3 {
+		for i := 0; i < 50; i++ {
+			s := md5.Sum(key)
+			key = s[:]
+		}
+	}
+	key = key[:n]
+
+	x := append([]byte(nil), h.o[:32]...)
+	if h.r == 2 {
+		return rc4Crypt(key, x)
+	}
+	for i := 19; i >= 0; i-- {
+		x = rc4Crypt(xorKey(key, byte(i)), x)
+	}
+	return x
+}
+
+// hashAES256 is the R5 hash and the R6 hash of Algorithm 2.B.
+func (h *pdfSecurityHandler) hashAES256(pw, salt, udata []byte) []byte {
+	s := sha256.New()
+	s.Write(pw)
+	s.Write(salt)
+	s.Write(udata)
+	k := s.Sum(nil)
+	if h.r == 5 {
+		return k
+	}
+
+	for round := 0; ; round++ {
+		var k1 []byte
+		for i := 0; i < 64; i++ {
+			k1 = append(k1, pw...)
+			k1 = append(k1, k...)
+			k1 = append(k1, udata...)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+
+		if round >= 63 && int(e[len(e)-1]) <= round+1-32 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+// decryptStream decrypts the data of the stream object ref.
+func (c *pdfCrypt) decryptStream(ref pdfRef, dict pdfDict, data []byte) ([]byte, error) {
+	return c.decrypt(c.method, ref, data)
+}
+
+// decryptString decrypts a string that belongs to object ref.
+func (c *pdfCrypt) decryptString(ref pdfRef, data []byte) ([]byte, error) {
+	return c.decrypt(c.strMethod, ref, data)
+}
+
+// decrypt applies method with the key of object ref (Algorithm 1).
+func (c *pdfCrypt) decrypt(method string, ref pdfRef, data []byte) ([]byte, error) {
+	switch method {
+	case pdfCryptNone:
+		return data, nil
+	case pdfCryptAESV3:
+		return aesCBCDecrypt(c.key, data)
+	}
+
+	m := md5.New()
+	m.Write(c.key)
+	m.Write([]byte{byte(ref.num), byte(ref.num >> 8), byte(ref.num >> 16), byte(ref.gen), byte(ref.gen >> 8)})
+	if method == pdfCryptAESV2 {
+		m.Write([]byte("sAlT"))
+	}
+	key := m.Sum(nil)[:min(len(c.key)+5, 16)]
+
+	if method == pdfCryptAESV2 {
+		return aesCBCDecrypt(key, data)
+	}
+	return rc4Crypt(key, data), nil
+}
+
+func rc4Crypt(key, data []byte) []byte {
+	c, _ := rc4.NewCipher(key)
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+func xorKey(key []byte, x byte) []byte {
+	out := make([]byte, len(key))
+	for i, b := range key {
+		out[i] = b ^ x
+	}
+	return out
+}
+
+// aesCBCDecrypt decrypts data laid out as a 16-byte IV followed by
+// PKCS#7 padded ciphertext.
+func aesCBCDecrypt(key, data []byte) ([]byte, error) {
+	if len(data) < 2*aes.BlockSize {
+		if len(data) == aes.BlockSize || len(data) == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("AES data too short (%d bytes)", len(data))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	body := data[aes.BlockSize:]
+	body = body[:len(body)-len(body)%aes.BlockSize]
+	out := make([]byte, len(body))
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, body)
+	if pad := int(out[len(out)-1]); pad >= 1 && pad <= aes.BlockSize && pad <= len(out) {
+		out = out[:len(out)-pad]
+	}
+	return out, nil
+}
+
+// aesCBCDecryptNoPad decrypts a key wrapped with a zero IV (UE, OE).
+func aesCBCDecryptNoPad(key, data []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(out, data)
+	return out
+}
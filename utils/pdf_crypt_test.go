@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// encryptedPDF lays out an Info dictionary whose Title is the hex string
+// title as object 4 and the Encrypt dictionary as object 5.
+func encryptedPDF(encrypt, id, title string) []byte {
+	pdf := buildPDF("<< /Type /Catalog >>", "<< >>", "<< >>", "<< /Title <"+title+"> >>", encrypt)
+	trailer := fmt.Sprintf("<< /Root 1 0 R /Info 4 0 R /Encrypt 5 0 R /ID [<%s> <%s>] >>", id, id)
+	return bytes.Replace(pdf, []byte("<< /Root 1 0 R >>"), []byte(trailer), 1)
+}
+
+// The vectors are documents encrypted by pdfcpu with owner password
+// "owner", except R3, which pdfcpu does not write; its O, U and file key
+// were computed separately with Algorithms 2, 3 and 5. key is the file key
+// of Algorithm 2 (R2-R4) or the one wrapped in UE and OE (R5, R6). Every
+// Title decrypts to "Aadhaar e-KYC".
+var pdfCryptVectors = []struct {
+	name    string
+	encrypt string
+	id      string
+	title   string
+	user    string
+	key     string
+}{
+	{
+		name:    "RC4 40-bit R2",
+		encrypt: "<</Filter/Standard/O<94e8094419662a774442fb072e3d9f19e9d130ec09a4d0061e78fe920f7ab62f>/P -3901/R 2/U<d0bf7c641650b9a2bd3326eb967dd0758e8d3575c21426c0ac8b22d7d9fab379>/V 1>>",
+		id:      "490D6D11C99CB698A6C822CBFD1ACF7A",
+		title:   "5da8d0f9eeb133d4999e16cf90",
+		user:    "user",
+		key:     "f36f8e6a3c",
+	},
+	{
+		name:    "RC4 128-bit R3",
+		encrypt: "<</Filter/Standard/Length 128/O<0ba3835f88f90388e74e54584125ce142be0de24c6b0d37746e075b891756671>/P -3904/R 3/U<c9bbe2a3956ec521581a87749e0bc91a00000000000000000000000000000000>/V 2>>",
+		id:      "0123456789abcdeffedcba9876543210",
+		title:   "d80f7867655a35682716e02613",
+		user:    "user",
+		key:     "16edc0dbea01045469e3195f056a94bd",
+	},
+	{
+		name:    "RC4 128-bit R4 crypt filter",
+		encrypt: "<</CF<</StdCF<</AuthEvent/DocOpen/CFM/V2/Length 128>>>>/Filter/Standard/Length 128/O<0ba3835f88f90388e74e54584125ce142be0de24c6b0d37746e075b891756671>/P -3901/R 4/StmF/StdCF/StrF/StdCF/U<a0ab99a1cc2cbd5dd98e8a33e16aef8600000000000000000000000000000000>/V 4>>",
+		id:      "F6E6EA2A82FF059C27C0BD2FCE6552D2",
+		title:   "f3ec1b0f8633124c82477e623f",
+		user:    "user",
+		key:     "434e7fbb3d99188720fbb3ca941121f7",
+	},
+	{
+		name:    "AES-128 R4",
+		encrypt: "<</CF<</StdCF<</AuthEvent/DocOpen/CFM/AESV2/Length 128>>>>/Filter/Standard/Length 128/O<0ba3835f88f90388e74e54584125ce142be0de24c6b0d37746e075b891756671>/P -3901/R 4/StmF/StdCF/StrF/StdCF/U<25bd7c8eff8294699d6c50e48b57ce2200000000000000000000000000000000>/V 4>>",
+		id:      "9897404B5C9A8739FBA6AAEC506B622C",
+		title:   "519231bf83bc47dec8ae134c797ed2cf2ef55cec79111e04124c994e3868c9c9",
+		user:    "user",
+		key:     "6e5b00dbde39ac11679d32d569815241",
+	},
+	{
+		name:    "AES-128 R4 empty user password",
+		encrypt: "<</CF<</StdCF<</AuthEvent/DocOpen/CFM/AESV2/Length 128>>>>/Filter/Standard/Length 128/O<566fa873ee33c797cd3b904fdadf814afa34df9a38f6ed41b984e2c6da2aa6f5>/P -3901/R 4/StmF/StdCF/StrF/StdCF/U<826220ac3a196011b194b68ece18f45d00000000000000000000000000000000>/V 4>>",
+		id:      "488CC7E4A6CF35CFB4B04CF8A20866DF",
+		title:   "9b3bd47f08841201322565023e9b39c5f91febc814ab3bfebfe18b4b76ae2ac4",
+		user:    "",
+		key:     "58c11a5bbad0e0146e60c23dd38c5125",
+	},
+	{
+		name:    "AES-256 R5",
+		encrypt: "<</CF<</StdCF<</AuthEvent/DocOpen/CFM/AESV3/Length 256>>>>/Filter/Standard/Length 256/O<02608f2f8600f26c56ac7e8f9723be0fca57905b97f9bcd19487c229a30af5f8f38026ad297878aed08791cde7cbd61e>/OE<885edb2798061e59b01887450f87ba7abba7d351c77451fad1d2548bb978963a>/P -3901/Perms<4da1db800131a764e226e0fc46878e3c>/R 5/StmF/StdCF/StrF/StdCF/U<94e8ca8e815ce2657d80c91ca69e6086b6a01822dc8bf140f21734c7a771819f558cf9facafc27e095dc76ab2846ad82>/UE<c89ef72b572a3d13bf45a5a8079ce27dcfb9219562b0f62aac982764b402f0d7>/V 5>>",
+		id:      "EE91C58ECD9574988789D7A46DFB7103",
+		title:   "d494e340740b792632b4e73a41a404eae6252aed209aa637b88f1a6e9b5c748a",
+		user:    "user",
+		key:     "87301d3bd44ab0ff7bf986d65e99686a22b1f036814453df71675c9d00e35de1",
+	},
+	{
+		name:    "AES-256 R6",
+		encrypt: "<</CF<</StdCF<</AuthEvent/DocOpen/CFM/AESV3/Length 32>>>>/Filter/Standard/Length 256/O<fae097813ad968edfa39ba95ec96a8498fa80fcfe0093bf935d88f3374db5e7d4416fb3ee4ffcdf2559bcf6ab1836e4a>/OE<d427d0a2a9faded09f84a9dfb3b981a5524c8c51f3426fa375dfb371e7961e6f>/P -3901/Perms<8268831e1f4672da53e6202c7f2db6b0>/R 6/StmF/StdCF/StrF/StdCF/U<f8da399fa1d1987e26f39f491eefd8032df013d8cd9e46b7edcba1caae33b440837d31027fcdfab3cc44b6fd0ec7244c>/UE<2c6128be51ce62b0417f33a09ccab3ef0f739d0a05157232a669b4ae0b698fb8>/V 5>>",
+		id:      "926F22F2CE35D0E35EB06A90E4B9724C",
+		title:   "e7e645032c5011419541f082a3a72c14fe9161c17ffff8b94dba06385cbc714b",
+		user:    "user",
+		key:     "ba16432e218c853b49a7161ce2d516192f9e21ccc9d1a001ff0d23b00efe7fd2",
+	},
+}
+
+func TestPDFSecurityHandlerVectors(t *testing.T) {
+	for _, tt := range pdfCryptVectors {
+		t.Run(tt.name, func(t *testing.T) {
+			pdf := encryptedPDF(tt.encrypt, tt.id, tt.title)
+			doc, err := parsePDF(pdf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := doc.securityHandler()
+			if err != nil || h == nil {
+				t.Fatalf("securityHandler = %v, %v", h, err)
+			}
+
+			for _, pw := range []string{tt.user, "owner"} {
+				key, ok := h.authenticate(pw)
+				if !ok {
+					t.Fatalf("password %q rejected", pw)
+				}
+				if got := hex.EncodeToString(key); got != tt.key {
+					t.Errorf("password %q: file key %s, want %s", pw, got, tt.key)
+				}
+			}
+			if _, ok := h.authenticate("wrong"); ok {
+				t.Error("wrong password accepted")
+			}
+			if !pdfOwnerPasswordOnly(pdf, "owner") {
+				t.Error("owner password not recognised as owner-only")
+			}
+			if pdfOwnerPasswordOnly(pdf, tt.user) {
+				t.Error("user password reported as owner-only")
+			}
+
+			if err := doc.setupEncryption(tt.user); err != nil {
+				t.Fatal(err)
+			}
+			ct, _ := hex.DecodeString(tt.title)
+			title, err := doc.crypt.decryptString(pdfRef{num: 4}, ct)
+			if err != nil || string(title) != "Aadhaar e-KYC" {
+				t.Errorf("Title = %q, %v", title, err)
+			}
+			// Below AES-256 the key is per object (Algorithm 1): another
+			// object number garbles it.
+			other, _ := doc.crypt.decryptString(pdfRef{num: 5}, ct)
+			if doc.crypt.strMethod != pdfCryptAESV3 && string(other) == "Aadhaar e-KYC" {
+				t.Error("Title decrypted with the key of object 5")
+			}
+		})
+	}
+}
+
+func TestPDFSetupEncryption(t *testing.T) {
+	protected := pdfCryptVectors[3]
+	open := pdfCryptVectors[4]
+	tests := []struct {
+		name     string
+		pdf      []byte
+		password string
+		wantErr  error
+	}{
+		{"user password", encryptedPDF(protected.encrypt, protected.id, protected.title), "user", nil},
+		{"owner password", encryptedPDF(protected.encrypt, protected.id, protected.title), "owner", nil},
+		{"no password", encryptedPDF(protected.encrypt, protected.id, protected.title), "", ErrPDFPasswordRequired},
+		{"wrong password", encryptedPDF(protected.encrypt, protected.id, protected.title), "wrong", ErrPDFBadPassword},
+		{"empty user password", encryptedPDF(open.encrypt, open.id, open.title), "", nil},
+		{"empty user password ignores a wrong one", encryptedPDF(open.encrypt, open.id, open.title), "wrong", nil},
+		{"not encrypted", buildPDF("<< /Type /Catalog >>"), "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parsePDF(tt.pdf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := doc.setupEncryption(tt.password); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPDFSecurityHandlerMalformed(t *testing.T) {
+	o32 := "<" + string(bytes.Repeat([]byte("00"), 32)) + ">"
+	tests := []struct {
+		name    string
+		encrypt string
+	}{
+		{"public key handler", "<< /Filter /Adobe.PubSec /V 4 /R 4 >>"},
+		{"unsupported version", "<< /Filter /Standard /V 3 /R 3 /O " + o32 + " /U " + o32 + " >>"},
+		{"short O", "<< /Filter /Standard /V 2 /R 3 /O <00> /U " + o32 + " >>"},
+		{"R6 without OE and UE", "<< /Filter /Standard /V 5 /R 6 /O " + o32 + " /U " + o32 + " >>"},
+		{"undefined crypt filter", "<< /Filter /Standard /V 4 /R 4 /StmF /StdCF /O " + o32 + " /U " + o32 + " >>"},
+		{"AESV3 streams below R5", "<< /Filter /Standard /V 4 /R 4 /CF << /StdCF << /CFM /AESV3 >> >> /StmF /StdCF /O " + o32 + " /U " + o32 + " >>"},
+		{"AESV3 strings below R5", "<< /Filter /Standard /V 5 /R 4 /CF << /StdCF << /CFM /AESV3 >> >> /StrF /StdCF /O " + o32 + " /U " + o32 + " >>"},
+		{"unknown crypt filter method", "<< /Filter /Standard /V 4 /R 4 /CF << /StdCF << /CFM /AESV4 >> >> /StmF /StdCF /O " + o32 + " /U " + o32 + " >>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdf := encryptedPDF(tt.encrypt, "00", "00")
+			doc, err := parsePDF(pdf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h, err := doc.securityHandler(); err == nil {
+				t.Errorf("got handler %+v, want error", h)
+			}
+			if _, err := ExtractPDFImages(pdf, "owner"); err == nil {
+				t.Error("ExtractPDFImages succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// PageRenderer rasterizes PDF pages. Embedded images cover the common
+// e-Aadhaar case; a renderer catches QR codes drawn as vector paths.
+type PageRenderer interface {
+	Name() string
+	RenderPages(pdf []byte, password string) ([]image.Image, error)
+}
+
+var (
+	renderersMu    sync.RWMutex
+	renderers      = make(map[string]PageRenderer)
+	activeRenderer string
+)
+
+func init() {
+	RegisterPageRenderer(&PopplerRenderer{Command: "pdftoppm", DPI: 300})
+}
+
+// RegisterPageRenderer makes r selectable through SetPageRenderer.
+func RegisterPageRenderer(r PageRenderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	renderers[r.Name()] = r
+}
+
+// SetPageRenderer selects the renderer LoadImage uses for PDFs. The
+// empty name disables page rendering, which is the default.
+func SetPageRenderer(name string) error {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	if _, ok := renderers[name]; !ok && name != "" {
+		return fmt.Errorf("unknown PDF page renderer %q", name)
+	}
+	activeRenderer = name
+	return nil
+}
+
+func getPageRenderer() PageRenderer {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	return renderers[activeRenderer]
+}
+
+// PopplerRenderer renders pages by running poppler's pdftoppm.
+type PopplerRenderer struct {
+	Command string
+	DPI     int
+}
+
+func (r *PopplerRenderer) Name() string { return filepath.Base(r.Command) }
+
+// RenderPages runs pdftoppm on a temporary copy of pdf. pdftoppm only
+// takes passwords on its command line, so while it runs the password is
+// visible to other local users in the process list; do not enable this
+// renderer on shared hosts if that matters.
+func (r *PopplerRenderer) RenderPages(pdf []byte, password string) ([]image.Image, error) {
+	dir, err := os.MkdirTemp("", "qr-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.pdf")
+	if err := os.WriteFile(in, pdf, 0o600); err != nil {
+		return nil, err
+	}
+	args := []string{"-r", strconv.Itoa(r.DPI), "-png"}
+	if password != "" {
+		// Poppler checks -upw only against the user password.
+		flag := "-upw"
+		if pdfOwnerPasswordOnly(pdf, password) {
+			flag = "-opw"
+		}
+		args = append(args, flag, password)
+	}
+	args = append(args, in, filepath.Join(dir, "page"))
+	if out, err := exec.Command(r.Command, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", r.Command, err, out)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if err != nil {
+		return nil, err
+	}
+	// pdftoppm zero pads page numbers to a common width, so a plain sort
+	// keeps page order.
+	sort.Strings(files)
+	var pages []image.Image
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		img, err := DecodeImage(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(f), err)
+		}
+		pages = append(pages, img)
+	}
+	return pages, nil
+}
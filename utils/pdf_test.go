@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+// buildPDF lays out numbered objects as a minimal PDF; stream objects are
+// given as "<<dict>>" plus data.
+func buildPDF(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func pdfStreamObj(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func TestExtractPDFImagesMalformed(t *testing.T) {
+	gray := pdfStreamObj("/Type /XObject /Subtype /Image /Width 21 /Height 21 /BitsPerComponent 8 /ColorSpace 2 0 R", make([]byte, 21*21))
+
+	tests := []struct {
+		name string
+		pdf  []byte
+	}{
+		{"self-referencing Indexed color space", buildPDF(gray, "[/Indexed 2 0 R 1 <00>]")},
+		{"mutually referencing color spaces", buildPDF(gray, "[/Indexed 3 0 R 1 <00>]", "[/Indexed 2 0 R 1 <00>]")},
+		{"deeply nested arrays", buildPDF(gray, strings.Repeat("[", 1<<20))},
+		{"deeply nested dictionaries", buildPDF(gray, strings.Repeat("<< /A ", 1<<18))},
+		{"overflowing dimensions", buildPDF(
+			pdfStreamObj("/Subtype /Image /Width 2147483648 /Height 1073741824 /BitsPerComponent 16 /ColorSpace /DeviceCMYK", []byte{1, 2, 3, 4}),
+		)},
+		{"negative dimensions", buildPDF(
+			pdfStreamObj("/Subtype /Image /Width -40 /Height -40 /BitsPerComponent 8 /ColorSpace /DeviceGray", []byte{1, 2, 3, 4}),
+		)},
+		{"short image data", buildPDF(
+			pdfStreamObj("/Subtype /Image /Width 100 /Height 100 /BitsPerComponent 8 /ColorSpace /DeviceRGB", make([]byte, 100)),
+		)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := ExtractPDFImages(tt.pdf, "")
+			if err != nil {
+				return
+			}
+			if len(images) != 0 {
+				t.Errorf("got %d images, want none", len(images))
+			}
+		})
+	}
+}
+
+func TestExtractPDFImagesGray(t *testing.T) {
+	data := make([]byte, 21*21)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(data)
+	zw.Close()
+
+	pdf := buildPDF(pdfStreamObj("/Subtype /Image /Width 21 /Height 21 /BitsPerComponent 8 /ColorSpace /DeviceGray /Filter /FlateDecode", z.Bytes()))
+	images, err := ExtractPDFImages(pdf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 {
+		t.Fatalf("got %d images, want 1", len(images))
+	}
+	if got := color.GrayModel.Convert(images[0].At(3, 1)).(color.Gray).Y; got != 24 {
+		t.Errorf("pixel (3,1) = %d, want 24", got)
+	}
+}
+
+func TestInflateLimit(t *testing.T) {
+	defer func(n int) { maxPDFStreamSize = n }(maxPDFStreamSize)
+	maxPDFStreamSize = 1 << 10
+
+	tests := []struct {
+		size    int
+		wantErr bool
+	}{
+		{1 << 10, false},
+		{1<<10 + 1, true},
+		{1 << 20, true},
+	}
+	for _, tt := range tests {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(make([]byte, tt.size))
+		zw.Close()
+
+		out, err := (&pdfDoc{}).inflate(z.Bytes(), nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("inflate(%d bytes): err = %v, want error %v", tt.size, err, tt.wantErr)
+		}
+		if err == nil && len(out) != tt.size {
+			t.Errorf("inflate(%d bytes) returned %d bytes", tt.size, len(out))
+		}
+	}
+}
+
+func TestColorSpaceEncryptedLookup(t *testing.T) {
+	crypt := &pdfCrypt{key: []byte{1, 2, 3, 4, 5}, method: pdfCryptRC4, strMethod: pdfCryptRC4}
+	lookup := []byte{0x00, 0x00, 0x00, 0xFF, 0x80, 0x40}
+
+	// The lookup string is encrypted with the key of the object that
+	// contains it: the image stream for an inline array, otherwise the
+	// color space object itself.
+	tests := []struct {
+		name  string
+		cs    interface{}
+		owner pdfRef
+	}{
+		{"inline", pdfArray{pdfName("Indexed"), pdfName("DeviceRGB"), 1, pdfString(nil)}, pdfRef{7, 0}},
+		{"indirect", pdfRef{3, 0}, pdfRef{3, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, _ := crypt.decryptString(tt.owner, lookup) // RC4 is symmetric
+			d := &pdfDoc{objects: map[pdfRef]interface{}{}, crypt: crypt}
+			cs := tt.cs
+			if ref, ok := cs.(pdfRef); ok {
+				d.objects[ref] = pdfArray{pdfName("Indexed"), pdfName("DeviceRGB"), 1, pdfString(enc)}
+			} else {
+				cs.(pdfArray)[3] = pdfString(enc)
+			}
+
+			comps, palette, _, err := d.colorSpace(cs, pdfRef{7, 0}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := color.Palette{color.RGBA{0, 0, 0, 0xFF}, color.RGBA{0xFF, 0x80, 0x40, 0xFF}}
+			if comps != 1 || fmt.Sprint(palette) != fmt.Sprint(want) {
+				t.Errorf("got %d components, palette %v; want 1, %v", comps, palette, want)
+			}
+		})
+	}
+}
+
+func TestColorSpaceIndexedHival(t *testing.T) {
+	lookup := pdfString(bytes.Repeat([]byte{0x10, 0x20, 0x30}, 300))
+	tests := []struct {
+		name   string
+		hival  int
+		lookup pdfString
+		want   int
+	}{
+		{"in range", 1, lookup, 2},
+		{"negative", -5, lookup, 1},
+		{"huge negative", -1 << 62, lookup, 1},
+		{"huge", 1 << 62, lookup, 256},
+		{"past 255", 300, lookup, 256},
+		{"past the lookup table", 200, lookup[:30], 10},
+		{"empty lookup table", 10, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &pdfDoc{objects: map[pdfRef]interface{}{}}
+			_, palette, _, err := d.colorSpace(pdfArray{pdfName("Indexed"), pdfName("DeviceRGB"), tt.hival, tt.lookup}, pdfRef{}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(palette) != tt.want || cap(palette) > 256 {
+				t.Errorf("palette has %d entries (cap %d), want %d", len(palette), cap(palette), tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeImageSizeLimit(t *testing.T) {
+	var small bytes.Buffer
+	if err := jpeg.Encode(&small, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// The same JPEG with a 65535x65535 frame header; only the header may
+	// be read.
+	huge := bytes.Clone(small.Bytes())
+	sof := bytes.Index(huge, []byte{0xFF, 0xC0})
+	binary.BigEndian.PutUint16(huge[sof+5:], 0xFFFF)
+	binary.BigEndian.PutUint16(huge[sof+7:], 0xFFFF)
+
+	tests := []struct {
+		name    string
+		filter  string
+		data    []byte
+		wantErr string
+	}{
+		{"jpeg", "/DCTDecode", small.Bytes(), ""},
+		{"huge jpeg", "/DCTDecode", huge, "65535x65535 out of range"},
+		{"huge jpeg2000", "/JPXDecode", j2kHeader(1<<20, 1<<20, 1), "1048576x1048576 out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &pdfDoc{objects: map[pdfRef]interface{}{}}
+			s := &pdfStream{dict: pdfDict{"Filter": pdfName(tt.filter[1:])}, data: tt.data}
+			img, err := d.decodeImage(s)
+			if tt.wantErr == "" {
+				if err != nil || img.Bounds().Dx() != 8 {
+					t.Fatalf("got %v, %v", img, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
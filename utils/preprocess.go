@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Preprocessor produces one candidate variant of a grayscale image.
+type Preprocessor struct {
+	Name  string
+	Apply func(*image.Gray) *image.Gray
+}
+
+// DefaultPreprocessors are tried in order after the untouched image;
+// cheap global fixes come before the local, more destructive ones.
+var DefaultPreprocessors = []Preprocessor{
+	{Name: "contrast_stretch", Apply: func(g *image.Gray) *image.Gray { return ContrastStretch(g, 0.01) }},
+	{Name: "clahe", Apply: func(g *image.Gray) *image.Gray { return CLAHE(g, 8, 4.0) }},
+	{Name: "adaptive_threshold", Apply: func(g *image.Gray) *image.Gray { return AdaptiveThreshold(g, 0, 2) }},
+	{Name: "sharpen", Apply: func(g *image.Gray) *image.Gray { return Sharpen(g, 1.0) }},
+	{Name: "median", Apply: MedianDenoise},
+	{Name: "gamma_0.5", Apply: func(g *image.Gray) *image.Gray { return Gamma(g, 0.5) }},
+	{Name: "gamma_2.0", Apply: func(g *image.Gray) *image.Gray { return Gamma(g, 2.0) }},
+	{Name: "invert", Apply: Invert},
+}
+
+// OriginalVariant names the untouched input image.
+const OriginalVariant = "original"
+
+// DecodeVariants tries the original image, then each preprocessed variant,
+// through the decoder chain until one decodes. Variants are generated
+// lazily so a clean image costs a single pass. The winning variant is
+// recorded in DecodeResult.Variant.
+func (r *DecoderRegistry) DecodeVariants(img image.Image, pre []Preprocessor) (*DecodeResult, error) {
+	return r.DecodeVariantsContext(context.Background(), img, pre)
+}
+
+// DecodeVariantsContext is DecodeVariants, checking ctx before every
+// variant.
+func (r *DecoderRegistry) DecodeVariantsContext(ctx context.Context, img image.Image, pre []Preprocessor) (*DecodeResult, error) {
+	res, err := r.DecodeContext(ctx, img)
+	if err == nil {
+		res.Variant = OriginalVariant
+		return res, nil
+	}
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	errs := []string{fmt.Sprintf("%s: %v", OriginalVariant, err)}
+
+	gray := toGray(img)
+	for _, p := range pre {
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		log.Printf("[preprocess] Trying variant %s\n", p.Name)
+		res, err := r.DecodeContext(ctx, p.Apply(gray))
+		if err == nil {
+			log.Printf("[preprocess] Variant %s decoded\n", p.Name)
+			res.Variant = p.Name
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", p.Name, err))
+	}
+	return nil, fmt.Errorf("no variant decoded: %s", strings.Join(errs, " | "))
+}
+
+// Invert swaps black and white, for light-on-dark prints.
+func Invert(src *image.Gray) *image.Gray {
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = 0xFF - uint8(i)
+	}
+	return mapGray(src, &lut)
+}
+
+// mapGray applies lut to every pixel of src, walking rows by stride so
+// sub-images with padding between rows are handled.
+func mapGray(src *image.Gray, lut *[256]uint8) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewGray(src.Rect)
+	for y := 0; y < h; y++ {
+		row := src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y):][:w]
+		dst := out.Pix[y*out.Stride:][:w]
+		for x, v := range row {
+			dst[x] = lut[v]
+		}
+	}
+	return out
+}
+
+// ContrastStretch linearly maps the [clip, 1-clip] percentile range of
+// the histogram onto 0..255, rescuing faded or low-contrast prints.
+func ContrastStretch(src *image.Gray, clip float64) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		for _, v := range src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y):][:w] {
+			hist[v]++
+		}
+	}
+
+	cut := int(clip * float64(w*h))
+	lo, hi, n := 0, 255, 0
+	for lo < 255 && n+hist[lo] <= cut {
+		n += hist[lo]
+		lo++
+	}
+	n = 0
+	for hi > 0 && n+hist[hi] <= cut {
+		n += hist[hi]
+		hi--
+	}
+	if hi <= lo {
+		return src
+	}
+
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = clampUint8(float64(i-lo) * 255 / float64(hi-lo))
+	}
+	return mapGray(src, &lut)
+}
+
+// Gamma applies out = 255 * (in/255)^gamma; gamma < 1 lifts shadows,
+// gamma > 1 pulls down washed-out highlights and glare.
+func Gamma(src *image.Gray, gamma float64) *image.Gray {
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = uint8(math.Round(255 * math.Pow(float64(i)/255, gamma)))
+	}
+	return mapGray(src, &lut)
+}
+
+// AdaptiveThreshold binarizes each pixel against the mean of its
+// (2*radius+1)² neighbourhood minus c. radius 0 picks one from the image
+// size, large enough that the window spans a whole finder pattern. Uses an
+// integral image so the cost is independent of radius.
+func AdaptiveThreshold(src *image.Gray, radius, c int) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if radius <= 0 {
+		radius = max(15, min(w, h)/8)
+	}
+
+	integral := make([]int64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var rowSum int64
+		for x := 0; x < w; x++ {
+			rowSum += int64(src.Pix[y*src.Stride+x])
+			integral[(y+1)*(w+1)+x+1] = integral[y*(w+1)+x+1] + rowSum
+		}
+	}
+
+	out := image.NewGray(src.Rect)
+	for y := 0; y < h; y++ {
+		y0, y1 := max(0, y-radius), min(h, y+radius+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(0, x-radius), min(w, x+radius+1)
+			sum := integral[y1*(w+1)+x1] - integral[y0*(w+1)+x1] - integral[y1*(w+1)+x0] + integral[y0*(w+1)+x0]
+			mean := sum / int64((x1-x0)*(y1-y0))
+			if int64(src.Pix[y*src.Stride+x]) < mean-int64(c) {
+				out.Pix[y*out.Stride+x] = 0
+			} else {
+				out.Pix[y*out.Stride+x] = 0xFF
+			}
+		}
+	}
+	return out
+}
+
+// CLAHE is contrast limited adaptive histogram equalization over a
+// tiles×tiles grid. Each tile's histogram is clipped at clipLimit times
+// the mean bin height, and per-tile mappings are bilinearly interpolated.
+func CLAHE(src *image.Gray, tiles int, clipLimit float64) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	tiles = max(1, min(tiles, min(w, h)))
+	tw := (w + tiles - 1) / tiles
+	th := (h + tiles - 1) / tiles
+
+	maps := make([][256]uint8, tiles*tiles)
+	for ty := 0; ty < tiles; ty++ {
+		for tx := 0; tx < tiles; tx++ {
+			x0, y0 := tx*tw, ty*th
+			x1, y1 := min(w, x0+tw), min(h, y0+th)
+			n := (x1 - x0) * (y1 - y0)
+			if n <= 0 {
+				for i := range maps[ty*tiles+tx] {
+					maps[ty*tiles+tx][i] = uint8(i)
+				}
+				continue
+			}
+
+			var hist [256]int
+			for y := y0; y < y1; y++ {
+				for _, v := range src.Pix[y*src.Stride+x0 : y*src.Stride+x1] {
+					hist[v]++
+				}
+			}
+
+			limit := int(clipLimit * float64(n) / 256)
+			if limit < 1 {
+				limit = 1
+			}
+			excess := 0
+			for i := range hist {
+				if hist[i] > limit {
+					excess += hist[i] - limit
+					hist[i] = limit
+				}
+			}
+			for i := range hist {
+				hist[i] += excess / 256
+			}
+
+			cdf := 0
+			for i := range hist {
+				cdf += hist[i]
+				maps[ty*tiles+tx][i] = uint8(min(255, cdf*255/n))
+			}
+		}
+	}
+
+	out := image.NewGray(src.Rect)
+	for y := 0; y < h; y++ {
+		fy := (float64(y)+0.5)/float64(th) - 0.5
+		ty0 := max(0, min(tiles-1, int(math.Floor(fy))))
+		ty1 := min(tiles-1, ty0+1)
+		wy := math.Max(0, math.Min(1, fy-float64(ty0)))
+		for x := 0; x < w; x++ {
+			fx := (float64(x)+0.5)/float64(tw) - 0.5
+			tx0 := max(0, min(tiles-1, int(math.Floor(fx))))
+			tx1 := min(tiles-1, tx0+1)
+			wx := math.Max(0, math.Min(1, fx-float64(tx0)))
+
+			v := src.Pix[y*src.Stride+x]
+			top := float64(maps[ty0*tiles+tx0][v])*(1-wx) + float64(maps[ty0*tiles+tx1][v])*wx
+			bot := float64(maps[ty1*tiles+tx0][v])*(1-wx) + float64(maps[ty1*tiles+tx1][v])*wx
+			out.Pix[y*out.Stride+x] = uint8(math.Round(top*(1-wy) + bot*wy))
+		}
+	}
+	return out
+}
+
+// Sharpen is an unsharp mask against a 3x3 box blur.
+func Sharpen(src *image.Gray, amount float64) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewGray(src.Rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sum, n := 0, 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					xx, yy := x+dx, y+dy
+					if xx < 0 || yy < 0 || xx >= w || yy >= h {
+						continue
+					}
+					sum += int(src.Pix[yy*src.Stride+xx])
+					n++
+				}
+			}
+			v := float64(src.Pix[y*src.Stride+x])
+			blur := float64(sum) / float64(n)
+			out.Pix[y*out.Stride+x] = clampUint8(v + amount*(v-blur))
+		}
+	}
+	return out
+}
+
+// MedianDenoise replaces each pixel by the median of its 3x3
+// neighbourhood, removing speckle noise while keeping module edges.
+func MedianDenoise(src *image.Gray) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	out := image.NewGray(src.Rect)
+	window := make([]int, 0, 9)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			window = window[:0]
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					xx := max(0, min(w-1, x+dx))
+					yy := max(0, min(h-1, y+dy))
+					window = append(window, int(src.Pix[yy*src.Stride+xx]))
+				}
+			}
+			sort.Ints(window)
+			out.Pix[y*out.Stride+x] = uint8(window[4])
+		}
+	}
+	return out
+}
+
+func clampUint8(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(math.Round(v))
+}
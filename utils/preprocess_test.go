@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"image"
+	"testing"
+)
+
+func TestPointOpsStride(t *testing.T) {
+	// 3x2 pixels in rows of 8 bytes; the padding must not be read.
+	padded := &image.Gray{
+		Pix: []uint8{
+			10, 20, 30, 99, 99, 99, 99, 99,
+			40, 50, 60, 99, 99, 99, 99, 99,
+		},
+		Stride: 8,
+		Rect:   image.Rect(0, 0, 3, 2),
+	}
+	// The same pixels as a sub-image at (1,1) of a larger one.
+	big := image.NewGray(image.Rect(0, 0, 5, 4))
+	for i := range big.Pix {
+		big.Pix[i] = 99
+	}
+	copy(big.Pix[1*5+1:], []uint8{10, 20, 30})
+	copy(big.Pix[2*5+1:], []uint8{40, 50, 60})
+	sub := big.SubImage(image.Rect(1, 1, 4, 3)).(*image.Gray)
+
+	tests := []struct {
+		name string
+		op   func(*image.Gray) *image.Gray
+		want []uint8
+	}{
+		{"invert", Invert, []uint8{245, 235, 225, 215, 205, 195}},
+		{"gamma 1", func(g *image.Gray) *image.Gray { return Gamma(g, 1) }, []uint8{10, 20, 30, 40, 50, 60}},
+		{"contrast stretch", func(g *image.Gray) *image.Gray { return ContrastStretch(g, 0) }, []uint8{0, 51, 102, 153, 204, 255}},
+	}
+	for _, tt := range tests {
+		for _, in := range []struct {
+			name string
+			img  *image.Gray
+		}{{"padded rows", padded}, {"sub-image", sub}} {
+			out := tt.op(in.img)
+			b := out.Bounds()
+			var got []uint8
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					got = append(got, out.GrayAt(x, y).Y)
+				}
+			}
+			if string(got) != string(tt.want) {
+				t.Errorf("%s, %s: got %v, want %v", tt.name, in.name, got, tt.want)
+			}
+		}
+	}
+}
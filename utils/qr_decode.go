@@ -1,19 +1,15 @@
 package utils
 
 import (
-	"bytes"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
 
 	"github.com/makiuchi-d/gozxing"
 	"github.com/makiuchi-d/gozxing/qrcode"
 )
 
 func DecodeQR(imgBytes []byte) ([]byte, error) {
-	// Decode PNG or JPEG
-	img, err := decodeImage(imgBytes)
+	// Decode any supported upload format (first page only)
+	img, err := DecodeImage(imgBytes)
 	if err != nil {
 		return nil, fmt.Errorf("image decode error: %v", err)
 	}
@@ -34,20 +30,10 @@ func DecodeQR(imgBytes []byte) ([]byte, error) {
 	reader := qrcode.NewQRCodeReader()
 
 	// Decode QR
-	result, err := reader.Decode(bitmap, nil)
+	result, err := reader.Decode(bitmap, zxingHints())
 	if err != nil {
 		return nil, fmt.Errorf("QR decode error: %v", err)
 	}
 
-	return []byte(result.GetText()), nil
-}
-
-func decodeImage(b []byte) (image.Image, error) {
-	if img, err := png.Decode(bytes.NewReader(b)); err == nil {
-		return img, nil
-	}
-	if img, err := jpeg.Decode(bytes.NewReader(b)); err == nil {
-		return img, nil
-	}
-	return nil, fmt.Errorf("unsupported image format")
+	return zxingPayload(result), nil
 }
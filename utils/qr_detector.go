@@ -1,14 +1,128 @@
 package utils
 
 import (
+	"fmt"
 	"image"
+	"image/color"
 	"log"
+	"sort"
+	"sync"
 )
 
-// DetectAndCropQR is a lightweight stub that simply returns
-// the original image without using OpenCV.
-// This keeps the rest of the code compiling cleanly.
+// Point is a position in source image pixel coordinates.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Detection is a located QR code: a rectified crop ready for the decoders
+// and the code's corners (top-left, top-right, bottom-right, bottom-left)
+// in the original image. Detectors that also decode set Payload.
+type Detection struct {
+	Image    image.Image `json:"-"`
+	Corners  [4]Point    `json:"corners"`
+	Payload  []byte      `json:"-"`
+	Detector string      `json:"detector"`
+}
+
+// Detector locates a QR code in an image.
+type Detector interface {
+	Name() string
+	Detect(img image.Image) (*Detection, error)
+}
+
+// DefaultDetector is the detector used when none has been selected.
+const DefaultDetector = "finder"
+
+var (
+	detectorsMu    sync.RWMutex
+	detectors      = make(map[string]Detector)
+	activeDetector = DefaultDetector
+)
+
+// RegisterDetector makes d selectable through SetDetector.
+func RegisterDetector(d Detector) {
+	detectorsMu.Lock()
+	defer detectorsMu.Unlock()
+	detectors[d.Name()] = d
+}
+
+// SetDetector selects the detector DetectQR and DetectAndCropQR use.
+func SetDetector(name string) error {
+	detectorsMu.Lock()
+	defer detectorsMu.Unlock()
+	if _, ok := detectors[name]; !ok {
+		return fmt.Errorf("unknown QR detector %q", name)
+	}
+	activeDetector = name
+	return nil
+}
+
+// DetectorNames lists the registered detectors.
+func DetectorNames() []string {
+	detectorsMu.RLock()
+	defer detectorsMu.RUnlock()
+	names := make([]string, 0, len(detectors))
+	for name := range detectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetDetector returns the named detector, or the active one for "".
+func GetDetector(name string) (Detector, error) {
+	detectorsMu.RLock()
+	defer detectorsMu.RUnlock()
+	if name == "" {
+		name = activeDetector
+	}
+	d, ok := detectors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown QR detector %q", name)
+	}
+	return d, nil
+}
+
+// DetectQR runs the active detector on img.
+func DetectQR(img image.Image) (*Detection, error) {
+	d, err := GetDetector("")
+	if err != nil {
+		return nil, err
+	}
+	det, err := d.Detect(img)
+	if err != nil {
+		return nil, err
+	}
+	if det.Detector == "" {
+		det.Detector = d.Name()
+	}
+	return det, nil
+}
+
+// DetectAndCropQR locates the QR code and returns a rectified,
+// quiet-zone padded crop of it.
 func DetectAndCropQR(img image.Image) (image.Image, error) {
-	log.Println("[Stub QR Detector] OpenCV disabled — returning original image")
-	return img, nil
+	det, err := DetectQR(img)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[detector] %s found QR at %v\n", det.Detector, det.Corners)
+	return det.Image, nil
+}
+
+// toGray converts img to 8-bit grayscale with its origin at (0,0),
+// reusing img if it already is one.
+func toGray(img image.Image) *image.Gray {
+	if g, ok := img.(*image.Gray); ok && g.Rect.Min == (image.Point{}) {
+		return g
+	}
+	b := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gray.SetGray(x-b.Min.X, y-b.Min.Y, color.GrayModel.Convert(img.At(x, y)).(color.Gray))
+		}
+	}
+	return gray
 }
@@ -1,14 +1,20 @@
+//go:build cgo && quirc
+
 package utils
 
 /*
-#cgo CFLAGS: -IC:/ProgramData/mingw64/mingw64/include
-#cgo LDFLAGS: -LC:/ProgramData/mingw64/mingw64/lib -lquirc
+#cgo windows CFLAGS: -IC:/ProgramData/mingw64/mingw64/include
+#cgo windows LDFLAGS: -LC:/ProgramData/mingw64/mingw64/lib -lquirc
+#cgo !windows LDFLAGS: -lquirc
 
 #include <stdlib.h>
 
 // Declaration only — REAL implementation is in quirc_wrapper.c
 int decode_qr_quirc(unsigned char *gray_data, int width, int height,
                     unsigned char *output, int *output_len);
+int decode_all_qr_quirc(unsigned char *gray_data, int width, int height,
+                        unsigned char *output, int output_cap,
+                        int *lengths, int *corners, int max_codes);
 */
 import "C"
 import (
@@ -19,6 +25,10 @@ import (
 	"unsafe"
 )
 
+func init() {
+	RegisterDecoder(NewMultiDecoderFunc("quirc", DecodeWithQuirc, DecodeAllWithQuirc))
+}
+
 // DecodeWithQuirc decodes a QR using native C Quirc.
 func DecodeWithQuirc(img image.Image) ([]byte, error) {
 	log.Println("[quirc] STEP A: Starting quirc decode")
@@ -61,3 +71,62 @@ func DecodeWithQuirc(img image.Image) ([]byte, error) {
 	log.Printf("[quirc] STEP D SUCCESS: Decoded %d bytes\n", outLen)
 	return output[:outLen], nil
 }
+
+// DecodeAllWithQuirc returns every QR code quirc finds and decodes, with
+// its corners (top-left, top-right, bottom-right, bottom-left).
+func DecodeAllWithQuirc(img image.Image) ([]*DecodeResult, error) {
+	log.Println("[quirc] Starting multi decode")
+
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	grayData := make([]byte, width*height)
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			grayData[i] = gray.Y
+			i++
+		}
+	}
+
+	output := make([]byte, maxQRCodes*10*1024)
+	lengths := make([]C.int, maxQRCodes)
+	corners := make([]C.int, 8*maxQRCodes)
+
+	count := C.decode_all_qr_quirc(
+		(*C.uchar)(unsafe.Pointer(&grayData[0])),
+		C.int(width),
+		C.int(height),
+		(*C.uchar)(unsafe.Pointer(&output[0])),
+		C.int(len(output)),
+		&lengths[0],
+		&corners[0],
+		C.int(maxQRCodes),
+	)
+
+	if count < 0 {
+		return nil, fmt.Errorf("quirc decode failed: code %d", count)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("quirc decode failed: no codes found")
+	}
+
+	results := make([]*DecodeResult, 0, int(count))
+	offset := 0
+	for i := 0; i < int(count); i++ {
+		n := int(lengths[i])
+		payload := append([]byte(nil), output[offset:offset+n]...)
+		offset += n
+
+		polygon := make([]Point, 4)
+		for k := range polygon {
+			polygon[k] = Point{float64(corners[8*i+2*k]), float64(corners[8*i+2*k+1])}
+		}
+		results = append(results, &DecodeResult{Payload: payload, Decoder: "quirc", Polygon: polygon})
+	}
+
+	log.Printf("[quirc] Multi decode SUCCESS, %d code(s)\n", count)
+	return results, nil
+}
@@ -0,0 +1,20 @@
+//go:build !(cgo && quirc)
+
+package utils
+
+import (
+	"fmt"
+	"image"
+)
+
+// DecodeWithQuirc is unavailable without the quirc build tag and cgo.
+// It is deliberately not registered, so the decoder chain falls back to
+// the pure-Go decoders.
+func DecodeWithQuirc(img image.Image) ([]byte, error) {
+	return nil, fmt.Errorf("quirc: %w", ErrDecoderUnavailable)
+}
+
+// DecodeAllWithQuirc is unavailable without the quirc build tag and cgo.
+func DecodeAllWithQuirc(img image.Image) ([]*DecodeResult, error) {
+	return nil, fmt.Errorf("quirc: %w", ErrDecoderUnavailable)
+}
@@ -1,3 +1,5 @@
+//go:build cgo && quirc
+
 #include <quirc.h>
 #include <stdlib.h>
 #include <string.h>
@@ -45,3 +47,56 @@ int decode_qr_quirc(unsigned char *gray_data, int width, int height,
     quirc_destroy(qr);
     return 0;
 }
+
+// Decodes every QR code in the image. Payloads are packed back to back
+// into output (output_cap bytes); lengths[i] is the size of code i and
+// corners[8*i..8*i+7] its top-left, top-right, bottom-right and
+// bottom-left corners as x,y pairs. Codes that fail to decode are
+// skipped. Returns the number of codes stored, at most max_codes.
+int decode_all_qr_quirc(unsigned char *gray_data, int width, int height,
+                        unsigned char *output, int output_cap,
+                        int *lengths, int *corners, int max_codes) {
+
+    struct quirc *qr = quirc_new();
+    if (!qr) return -1;
+
+    if (quirc_resize(qr, width, height) < 0) {
+        quirc_destroy(qr);
+        return -2;
+    }
+
+    int w, h;
+    uint8_t *buf = quirc_begin(qr, &w, &h);
+    if (!buf) {
+        quirc_destroy(qr);
+        return -3;
+    }
+
+    memcpy(buf, gray_data, width * height);
+    quirc_end(qr);
+
+    int count = quirc_count(qr);
+    int found = 0, used = 0;
+    for (int i = 0; i < count && found < max_codes; i++) {
+        struct quirc_code code;
+        struct quirc_data data;
+
+        quirc_extract(qr, i, &code);
+        if (quirc_decode(&code, &data) != QUIRC_SUCCESS)
+            continue;
+        if (used + data.payload_len > output_cap)
+            break;
+
+        memcpy(output + used, data.payload, data.payload_len);
+        used += data.payload_len;
+        lengths[found] = data.payload_len;
+        for (int k = 0; k < 4; k++) {
+            corners[8 * found + 2 * k] = code.corners[k].x;
+            corners[8 * found + 2 * k + 1] = code.corners[k].y;
+        }
+        found++;
+    }
+
+    quirc_destroy(qr);
+    return found;
+}
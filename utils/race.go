@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// RaceOptions configure DecodeRace.
+type RaceOptions struct {
+	// Workers bounds how many decoder calls run at once; zero means
+	// runtime.NumCPU().
+	Workers int
+	// Accept decides whether a decoded payload wins the race. A nil
+	// Accept takes the first non-empty payload.
+	Accept func(*DecodeResult) bool
+}
+
+// raceJob is one decoder run on one transformed, preprocessed image.
+type raceJob struct {
+	decoder   Decoder
+	transform string
+	variant   string
+	image     func() image.Image
+}
+
+// raceImage is a lazily built input image and the name of the transform
+// or variant that produced it.
+type raceImage struct {
+	name  string
+	image func() image.Image
+}
+
+type raceResult struct {
+	job raceJob
+	res *DecodeResult
+	err error
+}
+
+// raceJobs lists every (transform, variant, decoder) combination in the
+// order DecodeSearch would try them. Images are built on first use and
+// shared between the decoders that need them.
+func raceJobs(img image.Image, pre []Preprocessor, opts SearchOptions, decoders []Decoder) []raceJob {
+	b := img.Bounds()
+	gray := sync.OnceValue(func() *image.Gray { return toGray(img) })
+
+	var transforms []raceImage
+	if opts.MaxSide <= 0 || max(b.Dx(), b.Dy()) <= opts.MaxSide {
+		transforms = append(transforms, raceImage{"none", func() image.Image { return img }})
+	}
+	for _, step := range searchPlan(b.Dx(), b.Dy(), opts) {
+		out := sync.OnceValue(func() *image.Gray { return step.apply(gray()) })
+		transforms = append(transforms, raceImage{step.name, func() image.Image { return out() }})
+	}
+
+	var jobs []raceJob
+	for _, t := range transforms {
+		variants := []raceImage{{OriginalVariant, t.image}}
+		tGray := sync.OnceValue(func() *image.Gray { return toGray(t.image()) })
+		for _, p := range pre {
+			out := sync.OnceValue(func() *image.Gray { return p.Apply(tGray()) })
+			variants = append(variants, raceImage{p.Name, func() image.Image { return out() }})
+		}
+		for _, v := range variants {
+			for _, d := range decoders {
+				jobs = append(jobs, raceJob{decoder: d, transform: t.name, variant: v.name, image: v.image})
+			}
+		}
+	}
+	return jobs
+}
+
+// DecodeRace tries the same decoders, variants and transforms as
+// DecodeSearch, but concurrently on a bounded worker pool. The first
+// payload Accept approves wins and the remaining attempts are cancelled.
+// When no payload is accepted the earliest one decoded is returned, so a
+// race never does worse than the sequential chain.
+func (r *DecoderRegistry) DecodeRace(ctx context.Context, img image.Image, pre []Preprocessor, opts SearchOptions, race RaceOptions) (*DecodeResult, error) {
+	decoders := r.Decoders()
+	if len(decoders) == 0 {
+		return nil, fmt.Errorf("no QR decoders enabled")
+	}
+	workers := race.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan raceJob)
+	results := make(chan raceResult)
+	go func() {
+		defer close(jobs)
+		for _, j := range raceJobs(img, pre, opts, decoders) {
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				res, err := decodeWith(ctx, j.decoder, j.image())
+				results <- raceResult{j, res, err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	// Losers still report in after the winner is picked.
+	defer func() {
+		go func() {
+			for range results {
+			}
+		}()
+	}()
+
+	log.Printf("[race] Racing %v on %d workers\n", r.Names(), workers)
+	var fallback *DecodeResult
+	var errs []string
+	attempts := 0
+	for rr := range results {
+		attempts++
+		j := rr.job
+		if rr.err != nil || rr.res == nil || len(rr.res.Payload) == 0 {
+			if rr.err != nil && ctx.Err() == nil {
+				errs = append(errs, fmt.Sprintf("%s/%s/%s: %v", j.transform, j.variant, j.decoder.Name(), rr.err))
+			}
+			continue
+		}
+
+		res := rr.res
+		if res.Decoder == "" {
+			res.Decoder = j.decoder.Name()
+		}
+		res.Variant, res.Transform = j.variant, j.transform
+		res.Mode, res.Attempts = "race", attempts
+		if race.Accept == nil || race.Accept(res) {
+			log.Printf("[race] %s won on %s/%s after %d attempts\n", res.Decoder, j.transform, j.variant, attempts)
+			return res, nil
+		}
+		log.Printf("[race] %s payload on %s/%s rejected\n", res.Decoder, j.transform, j.variant)
+		if fallback == nil {
+			fallback = res
+		}
+	}
+
+	if parent.Err() != nil {
+		return nil, context.Cause(parent)
+	}
+	if fallback != nil {
+		log.Printf("[race] No payload accepted, using %s's\n", fallback.Decoder)
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("QR not found after %d race attempts: %s", attempts, strings.Join(errs, " || "))
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"strings"
+)
+
+// SearchOptions bound the geometric search DecodeSearch performs when the
+// image does not decode as is.
+type SearchOptions struct {
+	// MaxSide downscales larger images (12MP phone photos) to this many
+	// pixels on the long side before decoding.
+	MaxSide int
+	// MinSide upscales images whose short side is below it, so tiny,
+	// dense codes get at least a few pixels per module.
+	MinSide int
+	// UpscaleFactors are tried in order on images below MinSide.
+	UpscaleFactors []float64
+	// Rotate90 tries the 90°, 180° and 270° rotations.
+	Rotate90 bool
+	// DeskewAngles are small rotations in degrees tried last.
+	DeskewAngles []float64
+}
+
+var DefaultSearchOptions = SearchOptions{
+	MaxSide:        1600,
+	MinSide:        600,
+	UpscaleFactors: []float64{2, 3},
+	Rotate90:       true,
+	DeskewAngles:   []float64{-5, 5, -10, 10, -15, 15},
+}
+
+// searchStep is one geometric transform of the input.
+type searchStep struct {
+	name  string
+	apply func(*image.Gray) *image.Gray
+}
+
+// searchPlan lists the transforms to try for an image of the given size,
+// cheapest and most likely first.
+func searchPlan(w, h int, opts SearchOptions) []searchStep {
+	var steps []searchStep
+
+	long, short := max(w, h), min(w, h)
+	base := 1.0
+	if opts.MaxSide > 0 && long > opts.MaxSide {
+		base = float64(opts.MaxSide) / float64(long)
+		s := base
+		steps = append(steps, searchStep{fmt.Sprintf("scale_%.2f", s), func(g *image.Gray) *image.Gray { return Resize(g, s) }})
+		// Half of that again for codes that fill most of the frame.
+		s2 := base / 2
+		steps = append(steps, searchStep{fmt.Sprintf("scale_%.2f", s2), func(g *image.Gray) *image.Gray { return Resize(g, s2) }})
+	}
+	if opts.MinSide > 0 && short < opts.MinSide {
+		for _, f := range opts.UpscaleFactors {
+			steps = append(steps, searchStep{fmt.Sprintf("scale_%.2f", f), func(g *image.Gray) *image.Gray { return Resize(g, f) }})
+		}
+	}
+
+	// Rotations run on the base scale so large photos stay cheap.
+	atBase := func(g *image.Gray) *image.Gray {
+		if base < 1 {
+			return Resize(g, base)
+		}
+		return g
+	}
+	if opts.Rotate90 {
+		for _, k := range []int{1, 2, 3} {
+			steps = append(steps, searchStep{fmt.Sprintf("rotate_%d", k*90), func(g *image.Gray) *image.Gray { return Rotate90(atBase(g), k) }})
+		}
+	}
+	for _, a := range opts.DeskewAngles {
+		steps = append(steps, searchStep{fmt.Sprintf("deskew_%+.0f", a), func(g *image.Gray) *image.Gray { return RotateAngle(atBase(g), a) }})
+	}
+	return steps
+}
+
+// DecodeSearch runs DecodeVariants on the image as is and then on each
+// scaled and rotated version from the search plan, stopping at the first
+// success. The winning transform is recorded in DecodeResult.Transform.
+func (r *DecoderRegistry) DecodeSearch(img image.Image, pre []Preprocessor, opts SearchOptions) (*DecodeResult, error) {
+	return r.DecodeSearchContext(context.Background(), img, pre, opts)
+}
+
+// DecodeSearchContext is DecodeSearch, checking ctx before every search
+// step.
+func (r *DecoderRegistry) DecodeSearchContext(ctx context.Context, img image.Image, pre []Preprocessor, opts SearchOptions) (*DecodeResult, error) {
+	b := img.Bounds()
+	var errs []string
+
+	// Oversized photos skip the native pass; the plan starts with them
+	// scaled down to MaxSide instead.
+	if opts.MaxSide <= 0 || max(b.Dx(), b.Dy()) <= opts.MaxSide {
+		res, err := r.DecodeVariantsContext(ctx, img, pre)
+		if err == nil {
+			res.Transform = "none"
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		errs = append(errs, fmt.Sprintf("none: %v", err))
+	}
+
+	gray := toGray(img)
+	for _, step := range searchPlan(b.Dx(), b.Dy(), opts) {
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		log.Printf("[search] Trying %s\n", step.name)
+		res, err := r.DecodeVariantsContext(ctx, step.apply(gray), pre)
+		if err == nil {
+			log.Printf("[search] %s decoded\n", step.name)
+			res.Transform = step.name
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", step.name, err))
+	}
+	return nil, fmt.Errorf("QR not found after %d search steps: %s", len(errs), strings.Join(errs, " || "))
+}
+
+// Resize scales src by factor: area averaging when shrinking, bilinear
+// interpolation when enlarging.
+func Resize(src *image.Gray, factor float64) *image.Gray {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw := max(1, int(math.Round(float64(sw)*factor)))
+	dh := max(1, int(math.Round(float64(sh)*factor)))
+	out := image.NewGray(image.Rect(0, 0, dw, dh))
+
+	if factor < 1 {
+		for y := 0; y < dh; y++ {
+			y0 := y * sh / dh
+			y1 := max(y0+1, (y+1)*sh/dh)
+			for x := 0; x < dw; x++ {
+				x0 := x * sw / dw
+				x1 := max(x0+1, (x+1)*sw/dw)
+				sum := 0
+				for yy := y0; yy < y1; yy++ {
+					for _, v := range src.Pix[yy*src.Stride+x0 : yy*src.Stride+x1] {
+						sum += int(v)
+					}
+				}
+				out.Pix[y*out.Stride+x] = uint8(sum / ((x1 - x0) * (y1 - y0)))
+			}
+		}
+		return out
+	}
+
+	for y := 0; y < dh; y++ {
+		sy := (float64(y) + 0.5) / factor
+		for x := 0; x < dw; x++ {
+			out.Pix[y*out.Stride+x] = sampleBilinear(src, (float64(x)+0.5)/factor, sy)
+		}
+	}
+	return out
+}
+
+// Rotate90 rotates src clockwise by k quarter turns.
+func Rotate90(src *image.Gray, k int) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	k = ((k % 4) + 4) % 4
+	if k == 0 {
+		return src
+	}
+
+	dw, dh := w, h
+	if k%2 == 1 {
+		dw, dh = h, w
+	}
+	out := image.NewGray(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch k {
+			case 1:
+				dx, dy = h-1-y, x
+			case 2:
+				dx, dy = w-1-x, h-1-y
+			case 3:
+				dx, dy = y, w-1-x
+			}
+			out.Pix[dy*out.Stride+dx] = src.Pix[y*src.Stride+x]
+		}
+	}
+	return out
+}
+
+// RotateAngle rotates src clockwise by deg degrees around its centre,
+// growing the canvas to fit and filling the corners with white.
+func RotateAngle(src *image.Gray, deg float64) *image.Gray {
+	w, h := float64(src.Rect.Dx()), float64(src.Rect.Dy())
+	rad := deg * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+
+	dw := int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin)))
+	dh := int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos)))
+	out := image.NewGray(image.Rect(0, 0, dw, dh))
+
+	cx, cy := w/2, h/2
+	dcx, dcy := float64(dw)/2, float64(dh)/2
+	for y := 0; y < dh; y++ {
+		fy := float64(y) + 0.5 - dcy
+		for x := 0; x < dw; x++ {
+			fx := float64(x) + 0.5 - dcx
+			// inverse rotation back into the source
+			sx := cos*fx + sin*fy + cx
+			sy := -sin*fx + cos*fy + cy
+			out.Pix[y*out.Stride+x] = sampleBilinear(src, sx, sy)
+		}
+	}
+	return out
+}
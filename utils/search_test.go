@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDecodeSearchContextStops checks that once ctx expires no further
+// decoder call starts, for the sequential search, DecodeAll and the race.
+// Every call blocks until release, like a native decoder that cannot be
+// interrupted, and then fails.
+func TestDecodeSearchContextStops(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 200))
+	pre := DefaultPreprocessors
+	opts := DefaultSearchOptions
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, r *DecoderRegistry) error
+	}{
+		{"search", func(ctx context.Context, r *DecoderRegistry) error {
+			_, err := r.DecodeSearchContext(ctx, img, pre, opts)
+			return err
+		}},
+		{"all", func(ctx context.Context, r *DecoderRegistry) error {
+			_, err := r.DecodeAll(ctx, img, pre, opts)
+			return err
+		}},
+		{"race", func(ctx context.Context, r *DecoderRegistry) error {
+			_, err := r.DecodeRace(ctx, img, pre, opts, RaceOptions{Workers: 2})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			release := make(chan struct{})
+			block := func(image.Image) ([]byte, error) {
+				calls.Add(1)
+				<-release
+				return nil, errors.New("no QR")
+			}
+			r := NewDecoderRegistry()
+			r.Register(NewMultiDecoderFunc("blocking", block, func(img image.Image) ([]*DecodeResult, error) {
+				_, err := block(img)
+				return nil, err
+			}))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			if err := tt.run(ctx, r); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("err = %v, want deadline exceeded", err)
+			}
+			started := calls.Load()
+
+			// Let the abandoned calls finish; nothing new may start.
+			close(release)
+			time.Sleep(50 * time.Millisecond)
+			if got := calls.Load(); got != started {
+				t.Errorf("%d decoder calls after the deadline, %d before", got-started, started)
+			}
+		})
+	}
+}
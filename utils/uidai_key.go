@@ -43,7 +43,7 @@ import (
 )
 
 func LoadUIDAIPublicKey(path string) (*rsa.PublicKey, error) {
-	pemBytes, err := os.ReadFile("C:\\aadhaar-qr-service\\certs\\uidai_public_cert.pem")
+	pemBytes, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read err: %v", err)
 	}
@@ -1,14 +1,20 @@
+//go:build cgo && zbar
+
 package utils
 
 /*
-#cgo CFLAGS: -IC:/msys64/mingw64/include
-#cgo LDFLAGS: -LC:/msys64/mingw64/lib -lzbar
+#cgo windows CFLAGS: -IC:/msys64/mingw64/include
+#cgo windows LDFLAGS: -LC:/msys64/mingw64/lib -lzbar
+#cgo !windows LDFLAGS: -lzbar
 
 #include <stdlib.h>
 
 // Declaration only — actual implementation lives in zbar_wrapper.c
 int decode_qr_zbar(unsigned char *gray_data, int width, int height,
                    unsigned char *output, int *output_len);
+int decode_all_qr_zbar(unsigned char *gray_data, int width, int height,
+                       unsigned char *output, int output_cap,
+                       int *lengths, int *corners, int *points, int max_codes);
 */
 import "C"
 import (
@@ -19,6 +25,11 @@ import (
 	"unsafe"
 )
 
+func init() {
+	RegisterDecoder(NewMultiDecoderFunc("zbar", DecodeWithZBar, DecodeAllWithZBar))
+}
+
+// DecodeWithZBar decodes a QR using native C ZBar.
 func DecodeWithZBar(img image.Image) ([]byte, error) {
 	log.Println("[ZBar] STEP A: Starting ZBar decode")
 
@@ -56,3 +67,64 @@ func DecodeWithZBar(img image.Image) ([]byte, error) {
 	log.Printf("[ZBar] STEP D SUCCESS: Decoded %d bytes\n", outLen)
 	return output[:outLen], nil
 }
+
+// DecodeAllWithZBar returns every QR symbol ZBar finds, with the
+// location points ZBar reports for it.
+func DecodeAllWithZBar(img image.Image) ([]*DecodeResult, error) {
+	log.Println("[ZBar] Starting multi decode")
+
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	grayData := make([]byte, width*height)
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			grayData[i] = gray.Y
+			i++
+		}
+	}
+
+	output := make([]byte, maxQRCodes*10*1024)
+	lengths := make([]C.int, maxQRCodes)
+	corners := make([]C.int, 8*maxQRCodes)
+	points := make([]C.int, maxQRCodes)
+
+	count := C.decode_all_qr_zbar(
+		(*C.uchar)(unsafe.Pointer(&grayData[0])),
+		C.int(width),
+		C.int(height),
+		(*C.uchar)(unsafe.Pointer(&output[0])),
+		C.int(len(output)),
+		&lengths[0],
+		&corners[0],
+		&points[0],
+		C.int(maxQRCodes),
+	)
+
+	if count < 0 {
+		return nil, fmt.Errorf("zbar decode failed: code %d", count)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("zbar decode failed: no codes found")
+	}
+
+	results := make([]*DecodeResult, 0, int(count))
+	offset := 0
+	for i := 0; i < int(count); i++ {
+		n := int(lengths[i])
+		payload := append([]byte(nil), output[offset:offset+n]...)
+		offset += n
+
+		polygon := make([]Point, int(points[i]))
+		for k := range polygon {
+			polygon[k] = Point{float64(corners[8*i+2*k]), float64(corners[8*i+2*k+1])}
+		}
+		results = append(results, &DecodeResult{Payload: payload, Decoder: "zbar", Polygon: polygon})
+	}
+
+	log.Printf("[ZBar] Multi decode SUCCESS, %d code(s)\n", count)
+	return results, nil
+}
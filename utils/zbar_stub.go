@@ -0,0 +1,20 @@
+//go:build !(cgo && zbar)
+
+package utils
+
+import (
+	"fmt"
+	"image"
+)
+
+// DecodeWithZBar is unavailable without the zbar build tag and cgo.
+// It is deliberately not registered, so the decoder chain falls back to
+// the pure-Go decoders.
+func DecodeWithZBar(img image.Image) ([]byte, error) {
+	return nil, fmt.Errorf("zbar: %w", ErrDecoderUnavailable)
+}
+
+// DecodeAllWithZBar is unavailable without the zbar build tag and cgo.
+func DecodeAllWithZBar(img image.Image) ([]*DecodeResult, error) {
+	return nil, fmt.Errorf("zbar: %w", ErrDecoderUnavailable)
+}
@@ -1,3 +1,5 @@
+//go:build cgo && zbar
+
 #include <zbar.h>
 #include <stdlib.h>
 #include <string.h>
@@ -49,3 +51,64 @@ int decode_qr_zbar(unsigned char *gray_data, int width, int height,
 
     return 0;
 }
+
+// Decodes every QR symbol in the image. Payloads are packed back to back
+// into output (output_cap bytes); lengths[i] is the size of symbol i,
+// points[i] how many of its location points (at most 4) zbar reported and
+// corners[8*i..] those points as x,y pairs. Returns the number of symbols
+// stored, at most max_codes.
+int decode_all_qr_zbar(unsigned char *gray_data, int width, int height,
+                       unsigned char *output, int output_cap,
+                       int *lengths, int *corners, int *points, int max_codes) {
+
+    zbar_image_scanner_t *scanner = zbar_image_scanner_create();
+    if (!scanner)
+        return -1;
+
+    zbar_image_scanner_set_config(scanner, 0, ZBAR_CFG_ENABLE, 1);
+
+    zbar_image_t *img = zbar_image_create();
+    if (!img) {
+        zbar_image_scanner_destroy(scanner);
+        return -2;
+    }
+
+    zbar_image_set_format(img, ZBAR_Y800);
+    zbar_image_set_size(img, width, height);
+    zbar_image_set_data(img, gray_data, width * height, NULL);
+
+    if (zbar_scan_image(scanner, img) < 0) {
+        zbar_image_destroy(img);
+        zbar_image_scanner_destroy(scanner);
+        return -3;
+    }
+
+    int found = 0, used = 0;
+    const zbar_symbol_t *sym = zbar_image_first_symbol(img);
+    for (; sym && found < max_codes; sym = zbar_symbol_next(sym)) {
+        if (zbar_symbol_get_type(sym) != ZBAR_QRCODE)
+            continue;
+
+        unsigned int len = zbar_symbol_get_data_length(sym);
+        if (used + (int)len > output_cap)
+            break;
+
+        memcpy(output + used, zbar_symbol_get_data(sym), len);
+        used += len;
+        lengths[found] = len;
+
+        unsigned int n = zbar_symbol_get_loc_size(sym);
+        if (n > 4) n = 4;
+        for (unsigned int k = 0; k < n; k++) {
+            corners[8 * found + 2 * k] = zbar_symbol_get_loc_x(sym, k);
+            corners[8 * found + 2 * k + 1] = zbar_symbol_get_loc_y(sym, k);
+        }
+        points[found] = n;
+        found++;
+    }
+
+    zbar_image_destroy(img);
+    zbar_image_scanner_destroy(scanner);
+
+    return found;
+}
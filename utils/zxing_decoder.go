@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"log"
+	"math"
+
+	"github.com/makiuchi-d/gozxing"
+	multiqr "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+func init() {
+	RegisterDecoder(NewMultiDecoderFunc("zxing", DecodeWithZXing, DecodeAllWithZXing))
+}
+
+// DecodeWithZXing decodes a QR using the pure-Go gozxing reader.
+func DecodeWithZXing(img image.Image) ([]byte, error) {
+	log.Println("[ZX] STEP A: Starting ZXing decode")
+	log.Printf("[ZX] Image bounds → %v\n", img.Bounds())
+
+	// 1. Create luminance source
+	source := gozxing.NewLuminanceSourceFromImage(img)
+	if source == nil {
+		log.Println("[ZX] ERROR: Luminance source is nil")
+		return nil, fmt.Errorf("luminance source is nil")
+	}
+	log.Printf("[ZX] STEP B: Luminance source created (%dx%d)\n",
+		source.GetWidth(), source.GetHeight())
+
+	// 2. Binarizer
+	binarizer := gozxing.NewHybridBinarizer(source)
+	if binarizer == nil {
+		log.Println("[ZX] ERROR: HybridBinarizer returned nil")
+		return nil, fmt.Errorf("hybrid binarizer nil")
+	}
+	log.Println("[ZX] STEP C: Hybrid binarizer OK")
+
+	// 3. Binary bitmap
+	bmp, err := gozxing.NewBinaryBitmap(binarizer)
+	if err != nil {
+		log.Printf("[ZX] STEP D ERROR: Binary bitmap creation failed → %v\n", err)
+		return nil, fmt.Errorf("binary bitmap error: %v", err)
+	}
+	log.Println("[ZX] STEP D: Binary bitmap created")
+
+	// 4. ZXing QR decode
+	reader := qrcode.NewQRCodeReader()
+	log.Println("[ZX] STEP E: Attempting ZXing decode…")
+
+	result, err := reader.Decode(bmp, zxingHints())
+	if err != nil {
+		log.Printf("[ZX] STEP F ERROR: ZXing decode failed → %v\n", err)
+		return nil, fmt.Errorf("QR decode error: %v", err)
+	}
+
+	if result == nil {
+		log.Println("[ZX] STEP F ERROR: ZXing returned nil result")
+		return nil, fmt.Errorf("nil result from reader.Decode()")
+	}
+
+	payload := zxingPayload(result)
+	log.Printf("[ZX] STEP G: ZXing decode SUCCESS, length=%d\n", len(payload))
+
+	return payload, nil
+}
+
+// DecodeAllWithZXing returns every QR code gozxing's multi reader finds,
+// with its corners extrapolated from the finder patterns (zxingPolygon).
+func DecodeAllWithZXing(img image.Image) ([]*DecodeResult, error) {
+	log.Println("[ZX] Starting ZXing multi decode")
+
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return nil, fmt.Errorf("binary bitmap error: %v", err)
+	}
+	found, err := multiqr.NewQRCodeMultiReader().DecodeMultiple(bmp, zxingHints())
+	if err != nil {
+		return nil, fmt.Errorf("QR decode error: %v", err)
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("QR decode error: no codes found")
+	}
+
+	results := make([]*DecodeResult, 0, len(found))
+	for _, r := range found {
+		results = append(results, &DecodeResult{
+			Payload: zxingPayload(r),
+			Decoder: "zxing",
+			Polygon: zxingPolygon(r.GetResultPoints()),
+		})
+	}
+	log.Printf("[ZX] Multi decode SUCCESS, %d code(s)\n", len(results))
+	return results, nil
+}
+
+// zxingPolygon turns gozxing's bottom-left, top-left and top-right finder
+// pattern centres into the code's top-left, top-right, bottom-right and
+// bottom-left corners. The centres sit 3.5 modules in from the edges, and
+// dimension-7 modules apart; the dimension is estimated from the finder
+// module sizes the way gozxing's detector does. Without them the polygon
+// is the parallelogram through the centres.
+func zxingPolygon(points []gozxing.ResultPoint) []Point {
+	if len(points) < 3 {
+		return nil
+	}
+	bl, tl, tr := points[0], points[1], points[2]
+	// top and left are the finder centre spans along each side.
+	top := Point{tr.GetX() - tl.GetX(), tr.GetY() - tl.GetY()}
+	left := Point{bl.GetX() - tl.GetX(), bl.GetY() - tl.GetY()}
+	k := 0.0
+	if dim := zxingDimension(bl, tl, tr); dim > 7 {
+		k = 3.5 / float64(dim-7)
+	}
+	corner := func(p gozxing.ResultPoint, kt, kl float64) Point {
+		return Point{p.GetX() + kt*top.X + kl*left.X, p.GetY() + kt*top.Y + kl*left.Y}
+	}
+	return []Point{
+		corner(tl, -k, -k),
+		corner(tr, k, -k),
+		corner(tr, k, 1+k),
+		corner(bl, -k, k),
+	}
+}
+
+// zxingDimension estimates the symbol size in modules from the finder
+// patterns, or returns 0 when they carry no module size or give a
+// dimension no QR version has.
+func zxingDimension(bl, tl, tr gozxing.ResultPoint) int {
+	var moduleSize float64
+	for _, p := range []gozxing.ResultPoint{bl, tl, tr} {
+		fp, ok := p.(interface{ GetEstimatedModuleSize() float64 })
+		if !ok {
+			return 0
+		}
+		moduleSize += fp.GetEstimatedModuleSize() / 3
+	}
+	if moduleSize <= 0 {
+		return 0
+	}
+	modules := func(a, b gozxing.ResultPoint) int {
+		return int(math.Round(math.Hypot(a.GetX()-b.GetX(), a.GetY()-b.GetY()) / moduleSize))
+	}
+	dim := (modules(tl, tr)+modules(tl, bl))/2 + 7
+	switch dim & 3 {
+	case 0:
+		dim++
+	case 2:
+		dim--
+	case 3:
+		return 0
+	}
+	return dim
+}
+
+// zxingHints pins byte-mode segments to ISO-8859-1 so every byte maps to
+// exactly one rune and GetText() can be reversed without loss.
+func zxingHints() map[gozxing.DecodeHintType]interface{} {
+	return map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_CHARACTER_SET: "ISO-8859-1",
+	}
+}
+
+// zxingPayload recovers the original QR bytes from a gozxing result.
+// With the ISO-8859-1 hint the text is a 1:1 image of the payload; if a
+// segment still decoded outside Latin-1 (Kanji mode, an ECI switch) the
+// raw byte-mode segments are used instead.
+func zxingPayload(result *gozxing.Result) []byte {
+	text := result.GetText()
+
+	payload := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > 0xFF {
+			payload = nil
+			break
+		}
+		payload = append(payload, byte(r))
+	}
+	if payload != nil {
+		return payload
+	}
+
+	if segs, ok := result.GetResultMetadata()[gozxing.ResultMetadataType_BYTE_SEGMENTS].([][]byte); ok && len(segs) > 0 {
+		log.Println("[ZX] Non Latin-1 text, using raw byte segments")
+		return bytes.Join(segs, nil)
+	}
+	return []byte(text)
+}
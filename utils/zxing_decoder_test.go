@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// drawQR renders text as a QR code with scale-pixel modules and its
+// top-left corner at (x, y), and returns the code's width in pixels.
+func drawQR(t *testing.T, img draw.Image, text string, x, y, scale int) int {
+	t.Helper()
+	hints := map[gozxing.EncodeHintType]interface{}{gozxing.EncodeHintType_MARGIN: 0}
+	m, err := qrcode.NewQRCodeWriter().Encode(text, gozxing.BarcodeFormat_QR_CODE, 0, 0, hints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for my := 0; my < m.GetHeight(); my++ {
+		for mx := 0; mx < m.GetWidth(); mx++ {
+			if m.Get(mx, my) {
+				r := image.Rect(x+mx*scale, y+my*scale, x+(mx+1)*scale, y+(my+1)*scale)
+				draw.Draw(img, r, image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+	return m.GetWidth() * scale
+}
+
+func TestDecodeAllWithZXingPolygon(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 900, 500))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	type code struct {
+		text              string
+		x, y, scale, size int
+	}
+	codes := []code{
+		{text: "first code", x: 60, y: 80, scale: 8},
+		{text: "a second, longer code that needs a larger QR version", x: 480, y: 120, scale: 6},
+	}
+	for i := range codes {
+		codes[i].size = drawQR(t, img, codes[i].text, codes[i].x, codes[i].y, codes[i].scale)
+	}
+
+	results, err := DecodeAllWithZXing(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(codes) {
+		t.Fatalf("got %d codes, want %d", len(results), len(codes))
+	}
+	for _, res := range results {
+		var c *code
+		for i := range codes {
+			if codes[i].text == string(res.Payload) {
+				c = &codes[i]
+			}
+		}
+		if c == nil {
+			t.Fatalf("unexpected payload %q", res.Payload)
+		}
+		x0, y0, x1, y1 := float64(c.x), float64(c.y), float64(c.x+c.size), float64(c.y+c.size)
+		want := []Point{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+		if len(res.Polygon) != 4 {
+			t.Fatalf("%q: polygon %v", res.Payload, res.Polygon)
+		}
+		for i, p := range res.Polygon {
+			// within half a module of the true corner
+			if math.Hypot(p.X-want[i].X, p.Y-want[i].Y) > float64(c.scale)/2 {
+				t.Errorf("%q: corner %d = %v, want %v", res.Payload, i, p, want[i])
+			}
+		}
+	}
+}
+
+func TestZXingPolygonWithoutModuleSize(t *testing.T) {
+	bl, tl, tr := gozxing.NewResultPoint(10, 110), gozxing.NewResultPoint(10, 10), gozxing.NewResultPoint(110, 10)
+	got := zxingPolygon([]gozxing.ResultPoint{bl, tl, tr})
+	want := []Point{{10, 10}, {110, 10}, {110, 110}, {10, 110}}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if zxingPolygon([]gozxing.ResultPoint{bl, tl}) != nil {
+		t.Error("polygon from two points")
+	}
+}